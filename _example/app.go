@@ -17,6 +17,9 @@ func main() {
 	app.Config.Gorm.Type = "postgres"
 	app.Config.Gorm.Dialector = postgres.Open
 	app.Config.Gorm.LoggerLevel = eudore.LogDebug
+	app.Config.Tracer.Recent = 100
+	// 管理端口提供/metrics、/debug/traces
+	app.Config.Admin.Addr = "127.0.0.1:8090"
 
 	err := app.Parse()
 	if err != nil {
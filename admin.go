@@ -0,0 +1,168 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// AdminConfig 定义管理端口配置，在独立端口提供/metrics、/health、/debug/traces和/debug/pprof。
+//
+// Addr为空时不启动管理端口；Allows定义允许访问的ip或cidr；
+// 配置Token时允许Bearer认证，配置Username时允许Basic认证，同时配置时任意一种认证通过即可；
+// /health用于kubelet和负载均衡探测，不检查Allows和认证；
+// Gzip定义/metrics响应是否压缩，Timeout定义采集监控数据的超时时间。
+type AdminConfig struct {
+	Addr     string        `json:"addr" alias:"addr"`
+	Allows   []string      `json:"allows" alias:"allows"`
+	Username string        `json:"username" alias:"username"`
+	Password string        `json:"password" alias:"password"`
+	Token    string        `json:"token" alias:"token"`
+	Gzip     bool          `json:"gzip" alias:"gzip"`
+	Timeout  time.Duration `json:"timeout" alias:"timeout"`
+	Pprof    bool          `json:"pprof" alias:"pprof"`
+}
+
+// NewAdminServer 方法创建管理端口的http.Server。
+func (app *App) NewAdminServer() (*http.Server, error) {
+	config := &app.Config.Admin
+	allows, err := newAdminAllows(config.Allows)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	if app.Prometheus != nil {
+		mux.Handle("/metrics", promhttp.HandlerFor(app.Prometheus, promhttp.HandlerOpts{
+			ErrorLog:           adminLogger{app},
+			EnableOpenMetrics:  true,
+			DisableCompression: !config.Gzip,
+			Timeout:            config.Timeout,
+		}))
+	}
+	if app.Config.Tracer.RecentTraces != nil {
+		mux.Handle("/debug/traces", app.Config.Tracer.RecentTraces)
+	}
+	if config.Pprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return &http.Server{
+		Addr:              config.Addr,
+		Handler:           newAdminHandler(config, allows, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}, nil
+}
+
+// runAdminServer 方法启动管理端口，ctx结束后关闭。
+func (app *App) runAdminServer(ctx context.Context) error {
+	server, err := app.NewAdminServer()
+	if err != nil {
+		return err
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	app.Infof("admin server listen %s", server.Addr)
+
+	select {
+	case err = <-errs:
+		return err
+	case <-ctx.Done():
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(ctx)
+	}
+}
+
+type adminLogger struct {
+	app *App
+}
+
+func (log adminLogger) Println(args ...interface{}) {
+	log.app.Error(args...)
+}
+
+func newAdminAllows(allows []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(allows))
+	for _, allow := range allows {
+		if !strings.Contains(allow, "/") {
+			if strings.Contains(allow, ":") {
+				allow += "/128"
+			} else {
+				allow += "/32"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(allow)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// newAdminHandler 函数创建管理端口的访问控制处理函数。
+func newAdminHandler(config *AdminConfig, allows []*net.IPNet, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(allows) > 0 && !adminAllowIP(allows, r.RemoteAddr) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		if config.Token == "" && config.Username == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if config.Token != "" && strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(auth[7:]), []byte(config.Token)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if config.Username != "" {
+			user, pass, ok := r.BasicAuth()
+			if ok && subtle.ConstantTimeCompare([]byte(user), []byte(config.Username)) == 1 &&
+				subtle.ConstantTimeCompare([]byte(pass), []byte(config.Password)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+func adminAllowIP(allows []*net.IPNet, addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, allow := range allows {
+		if allow.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package endpoint
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eudore/endpoint/tracer"
+)
+
+func newTestAdminHandler(t *testing.T, config *AdminConfig) http.Handler {
+	allows, err := newAdminAllows(config.Allows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newAdminHandler(config, allows, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+}
+
+type adminRequest struct {
+	path     string
+	addr     string
+	token    string
+	username string
+	password string
+	status   int
+}
+
+func (req adminRequest) do(t *testing.T, name string, h http.Handler) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, req.path, nil)
+	r.RemoteAddr = req.addr
+	if req.token != "" {
+		r.Header.Set("Authorization", "Bearer "+req.token)
+	}
+	if req.username != "" {
+		r.SetBasicAuth(req.username, req.password)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != req.status {
+		t.Errorf("admin %s %+v status %d", name, req, w.Code)
+	}
+}
+
+func TestAdminHandlerAuth(t *testing.T) {
+	addr := "10.0.0.1:1234"
+	bearer := newTestAdminHandler(t, &AdminConfig{Token: "secret"})
+	for _, req := range []adminRequest{
+		{path: "/metrics", addr: addr, token: "secret", status: 200},
+		{path: "/metrics", addr: addr, token: "secre", status: 401},
+		{path: "/metrics", addr: addr, status: 401},
+		{path: "/metrics", addr: addr, username: "admin", password: "secret", status: 401},
+		{path: "/health", addr: addr, status: 200},
+	} {
+		req.do(t, "bearer", bearer)
+	}
+
+	basic := newTestAdminHandler(t, &AdminConfig{Username: "admin", Password: "pass"})
+	for _, req := range []adminRequest{
+		{path: "/metrics", addr: addr, username: "admin", password: "pass", status: 200},
+		{path: "/metrics", addr: addr, username: "admin", password: "bad", status: 401},
+		{path: "/metrics", addr: addr, username: "root", password: "pass", status: 401},
+		{path: "/metrics", addr: addr, token: "pass", status: 401},
+	} {
+		req.do(t, "basic", basic)
+	}
+
+	both := newTestAdminHandler(t, &AdminConfig{Token: "secret", Username: "admin", Password: "pass"})
+	for _, req := range []adminRequest{
+		{path: "/metrics", addr: addr, token: "secret", status: 200},
+		{path: "/metrics", addr: addr, username: "admin", password: "pass", status: 200},
+		{path: "/metrics", addr: addr, token: "bad", status: 401},
+		{path: "/metrics", addr: addr, status: 401},
+	} {
+		req.do(t, "both", both)
+	}
+
+	open := newTestAdminHandler(t, &AdminConfig{})
+	adminRequest{path: "/metrics", addr: addr, status: 200}.do(t, "open", open)
+}
+
+func TestAdminHandlerAllows(t *testing.T) {
+	h := newTestAdminHandler(t, &AdminConfig{
+		Allows: []string{"127.0.0.1", "10.1.0.0/16", "::1", "fd00::/8"},
+		Token:  "secret",
+	})
+	for _, req := range []adminRequest{
+		{path: "/metrics", addr: "127.0.0.1:1234", token: "secret", status: 200},
+		{path: "/metrics", addr: "10.1.2.3:1234", token: "secret", status: 200},
+		{path: "/metrics", addr: "[::1]:1234", token: "secret", status: 200},
+		{path: "/metrics", addr: "[fd00::1]:1234", token: "secret", status: 200},
+		{path: "/metrics", addr: "10.2.0.1:1234", token: "secret", status: 403},
+		{path: "/metrics", addr: "[fe80::1]:1234", token: "secret", status: 403},
+		{path: "/metrics", addr: "127.0.0.2:1234", token: "secret", status: 403},
+		{path: "/metrics", addr: "invalid", token: "secret", status: 403},
+		{path: "/metrics", addr: "10.1.2.3:1234", status: 401},
+		// 探测请求不检查来源和认证。
+		{path: "/health", addr: "10.2.0.1:1234", status: 200},
+	} {
+		req.do(t, "allows", h)
+	}
+
+	_, err := newAdminAllows([]string{"10.0.0.0/33"})
+	if err == nil {
+		t.Error("admin invalid cidr not rejected")
+	}
+}
+
+func TestAdminServer(t *testing.T) {
+	app := &App{Config: &Config{
+		Admin:  AdminConfig{Token: "secret"},
+		Tracer: tracer.Config{RecentTraces: tracer.NewRecentTraces(10)},
+	}}
+	server, err := app.NewAdminServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []adminRequest{
+		{path: "/health", addr: "10.0.0.1:1234", status: 200},
+		{path: "/debug/traces", addr: "10.0.0.1:1234", status: 401},
+		{path: "/debug/traces", addr: "10.0.0.1:1234", token: "secret", status: 200},
+		{path: "/debug/pprof/", addr: "10.0.0.1:1234", token: "secret", status: 404},
+	} {
+		req.do(t, "server", server.Handler)
+	}
+}
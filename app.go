@@ -4,9 +4,13 @@ Package endpoint 是eudore集成gorm、opentracing、prometheus等第三方库
 package endpoint
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/eudore/endpoint/gorm"
@@ -14,11 +18,15 @@ import (
 	"github.com/eudore/endpoint/tracer"
 	"github.com/eudore/eudore"
 	"github.com/eudore/eudore/policy"
+	"github.com/opentracing/opentracing-go"
 )
 
 // ApplicationServiceVersion 定义app的版本描述，可以编译时设置。
 var ApplicationServiceVersion = "0.0.0"
 
+// ErrPrometheusNotParsed 定义App.Prometheus未解析时使用prometheus的错误。
+var ErrPrometheusNotParsed = errors.New("endpoint prometheus is not parsed")
+
 // App 定义endpoint app 组合全部新组件。
 type App struct {
 	*Config
@@ -27,7 +35,12 @@ type App struct {
 	Policys    *policy.Policys
 	Tracer     tracer.Tracer
 	Prometheus prometheus.Prometheus
+	Metrics    *prometheus.Metrics
 	HTTP       *http.Client
+	// httpBase和httpRetry保存App.HTTP的基础client和添加重试后的client，
+	// 多次Parse时从基础client重新创建App.HTTP，避免重复包装。
+	httpBase  *http.Client
+	httpRetry *http.Client
 }
 
 //Config 定义endpoint全部组件配置。
@@ -38,8 +51,10 @@ type Config struct {
 	Config         string                 `json:"config" alias:"config"`
 	Logger         eudore.LoggerStdConfig `json:"logger" alias:"logger"`
 	Gorm           gorm.Config            `json:"gorm" alias:"gorm"`
-	// Prometheus     prometheus.Config `json:"prometheus" alias:"prometheus"`
-	Tracer tracer.Config `json:"tracing" alias:"tracing"`
+	Prometheus     prometheus.Config      `json:"prometheus" alias:"prometheus"`
+	Tracer         tracer.Config          `json:"tracing" alias:"tracing"`
+	Admin          AdminConfig            `json:"admin" alias:"admin"`
+	Retry          tracer.RetryConfig     `json:"retry" alias:"retry"`
 }
 
 // NewApp 函数创建新的endpoint App。
@@ -57,8 +72,11 @@ func NewApp(name string, options ...interface{}) *App {
 			eudore.NewLoggerInit(),
 			//			tracer.NewOpentracingLogger(),
 		),
-		HTTP: tracer.NewOpentracingHTTPClient(http.DefaultClient),
 	}
+	// 使用新的http.Client，避免修改http.DefaultClient影响进程内其他请求。
+	app.httpBase = tracer.NewOpentracingHTTPClient(&http.Client{})
+	app.httpRetry = app.httpBase
+	app.HTTP = app.httpBase
 	app.Options(options...)
 
 	// 定义配置解析方法
@@ -72,9 +90,10 @@ func NewApp(name string, options ...interface{}) *App {
 		eudore.ConfigParseWorkdir,
 		eudore.ConfigParseHelp,
 		app.NewParseLoggerFunc(),
+		app.NewParseRetryFunc(),
+		app.NewParsePrometheusFunc(),
 		app.NewParseGormFunc(),
 		app.NewParsePolicysFunc(),
-		app.NewParsePrometheusFunc(),
 		app.NewParseTracingFunc(),
 	})
 	app.AddHandlerExtend(NewExtendContext(app))
@@ -84,17 +103,27 @@ func NewApp(name string, options ...interface{}) *App {
 // NewParseLoggerFunc 方法创建一个日志配置解析函数。
 func (app *App) NewParseLoggerFunc() eudore.ConfigParseFunc {
 	return func(eudore.Config) error {
-		log := tracer.NewOpentracingLoggerStdData(eudore.NewLoggerStdDataJSON(&app.Config.Logger))
+		log := tracer.NewOpentracingLoggerStdDataConfig(eudore.NewLoggerStdDataJSON(&app.Config.Logger), &app.Config.Tracer)
 		app.Options(eudore.NewLoggerStd(log))
 		return nil
 	}
 }
 
+// NewParseRetryFunc 方法创建一个App.HTTP重试配置解析函数，使用基础client创建重试client。
+func (app *App) NewParseRetryFunc() eudore.ConfigParseFunc {
+	return func(eudore.Config) error {
+		app.httpRetry = tracer.NewRetryHTTPClient(app.httpBase, &app.Config.Retry)
+		app.HTTP = app.httpRetry
+		return nil
+	}
+}
+
 // NewParseGormFunc 方法创建一个Gorm配置解析函数。
 func (app *App) NewParseGormFunc() eudore.ConfigParseFunc {
 	return func(eudore.Config) error {
 		config := &app.Config.Gorm
 		config.Logger = app
+		config.Registerer = app.Prometheus
 		db, err := gorm.NewGorm(config)
 		if err != nil {
 			return err
@@ -145,14 +174,26 @@ func (app *App) NewPolicysController() eudore.Controller {
 // NewParsePrometheusFunc 方法创建一个Prometheus配置解析函数。
 func (app *App) NewParsePrometheusFunc() eudore.ConfigParseFunc {
 	return func(eudore.Config) error {
-		app.Prometheus = prometheus.NewPrometheus()
+		prom, err := prometheus.NewPrometheusConfig(&app.Config.Prometheus)
+		if err != nil {
+			return err
+		}
+		app.Prometheus = prom
+		app.Metrics = prometheus.NewMetrics(app.ServiceName, prom)
+		// 每次Parse创建新的registry，使用重试client重新创建App.HTTP，监控项只注册一次。
+		app.HTTP = prometheus.NewPrometheusHTTPClient(app.httpRetry, prom, &app.Config.Prometheus)
 		return nil
 	}
 }
 
 // NewPrometheusHandler 方法创建prometheus处理中间件函数。
 func (app *App) NewPrometheusHandler() eudore.HandlerFunc {
-	return prometheus.NewPrometheusHandler(app.ServiceName, app.Prometheus)
+	handler, err := prometheus.NewPrometheusHandlerConfig(app.ServiceName, app.Prometheus, &app.Config.Prometheus)
+	if err != nil {
+		app.Error(err)
+		return nil
+	}
+	return handler
 }
 
 // NewPrometheusMetrics 方法创建prometheus /metrics处理函数。
@@ -160,6 +201,25 @@ func (app *App) NewPrometheusMetrics() eudore.HandlerFunc {
 	return prometheus.NewPrometheusMetrics(app.Prometheus)
 }
 
+// NewPrometheusDashboard 方法使用App.Prometheus已注册的监控项生成Grafana dashboard json，
+// 需要在解析prometheus配置后调用。
+func (app *App) NewPrometheusDashboard(datasource string) ([]byte, error) {
+	if app.Prometheus == nil {
+		return nil, ErrPrometheusNotParsed
+	}
+	mfs, err := app.Prometheus.Gather()
+	if err != nil {
+		return nil, err
+	}
+	return prometheus.NewDashboard(&prometheus.DashboardConfig{
+		Title:      app.ServiceName,
+		Service:    app.ServiceName,
+		Datasource: datasource,
+		Namespace:  app.Config.Prometheus.Namespace,
+		Subsystem:  app.Config.Prometheus.Subsystem,
+	}, mfs)
+}
+
 // NewParseTracingFunc 方法创建Traing配置解析函数。
 func (app *App) NewParseTracingFunc() eudore.ConfigParseFunc {
 	return func(eudore.Config) error {
@@ -172,18 +232,72 @@ func (app *App) NewParseTracingFunc() eudore.ConfigParseFunc {
 			return err
 		}
 		app.Tracer = trace
-		app.Infof("init opentraceing to jaeger agent %s", config.Agent)
+		opentracing.SetGlobalTracer(trace)
+		app.Infof("init opentraceing to %s agent %s", config.Backend, config.Agent)
 		return nil
 	}
 }
 
 // NewOpentracingHandler 方法创建opentracing处理中间件函数。
 func (app *App) NewOpentracingHandler() eudore.HandlerFunc {
-	return tracer.NewOpentracingHandler(app.Tracer)
+	return tracer.NewOpentracingHandler(app.Tracer, app.Config.Tracer.Baggage.Fields...)
+}
+
+// NewTracerRecentHandler 方法创建最近trace查看处理函数，需要配置tracing.recent。
+//
+// 配置admin.addr时管理端口已挂载/debug/traces，不应该注册到公开路由。
+func (app *App) NewTracerRecentHandler() eudore.HandlerFunc {
+	return tracer.NewRecentHandler(app.Config.Tracer.RecentTraces)
+}
+
+// NewPrometheusPusher 方法创建推送App.Prometheus监控数据的Pusher，使用ServiceName作为job。
+func (app *App) NewPrometheusPusher() *prometheus.Pusher {
+	pusher := prometheus.NewPusher(app.ServiceName, app.Prometheus, &app.Config.Prometheus.Push)
+	pusher.Logger = app
+	return pusher
+}
+
+// NewPrometheusRemoteWriter 方法创建使用remote write发送App.Prometheus监控数据的RemoteWriter。
+func (app *App) NewPrometheusRemoteWriter() *prometheus.RemoteWriter {
+	writer := prometheus.NewRemoteWriter(app.Prometheus, app.Prometheus, &app.Config.Prometheus)
+	writer.Logger = app
+	return writer
 }
 
-// Run 方法启动endpoint App。
+// Run 方法启动endpoint App，App结束后关闭Tracer发送剩余span。
+//
+// 配置prometheus.push.url时周期推送监控数据，App结束后删除分组，配置keepgroup时推送最后一次数据；
+// 配置prometheus.remotewrite.url时周期使用remote write发送监控数据，App结束后发送剩余数据；
+// 配置admin.addr时启动管理端口。
 func (app *App) Run() error {
 	app.Listen(fmt.Sprintf(":%d", app.ServicePort))
-	return app.App.Run()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	var runs []func(context.Context) error
+	if app.Config.Prometheus.Push.URL != "" {
+		runs = append(runs, app.NewPrometheusPusher().Run)
+	}
+	if app.Config.Prometheus.RemoteWrite.URL != "" {
+		runs = append(runs, app.NewPrometheusRemoteWriter().Run)
+	}
+	if app.Config.Admin.Addr != "" {
+		runs = append(runs, app.runAdminServer)
+	}
+	for _, run := range runs {
+		wg.Add(1)
+		go func(run func(context.Context) error) {
+			defer wg.Done()
+			err := run(ctx)
+			if err != nil {
+				app.Error(err)
+			}
+		}(run)
+	}
+	err := app.App.Run()
+	cancel()
+	wg.Wait()
+	if closer, ok := app.Tracer.(io.Closer); ok {
+		closer.Close()
+	}
+	return err
 }
@@ -0,0 +1,98 @@
+package endpoint
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eudore/endpoint/tracer"
+)
+
+func TestAppHTTPParse(t *testing.T) {
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	base := &http.Client{}
+	app := &App{
+		Config:    &Config{ServiceName: "test", Retry: tracer.RetryConfig{MinBackoff: time.Millisecond}},
+		httpBase:  base,
+		httpRetry: base,
+		HTTP:      base,
+	}
+	// 多次Parse不重复包装App.HTTP，也不重复注册监控项。
+	for i := 0; i < 3; i++ {
+		for _, fn := range []func() error{
+			func() error { return app.NewParseRetryFunc()(nil) },
+			func() error { return app.NewParsePrometheusFunc()(nil) },
+		} {
+			if err := fn(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := app.NewParsePrometheusFunc()(nil); err != nil {
+		t.Fatal(err)
+	}
+	// App.HTTP只有监控和重试两层包装。
+	var depth int
+	for rt := app.HTTP.Transport; ; depth++ {
+		wrap, ok := rt.(interface{ RoundTripper() http.RoundTripper })
+		if !ok {
+			break
+		}
+		rt = wrap.RoundTripper()
+	}
+	if depth != 2 {
+		t.Errorf("app http transport depth %d", depth)
+	}
+
+	resp, err := app.HTTP.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := atomic.LoadInt32(&count); n != 3 {
+		t.Errorf("app http requests %d", n)
+	}
+	// 监控在重试外层，一个请求只记录一次。
+	mfs, err := app.Prometheus.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total float64
+	for _, mf := range mfs {
+		if mf.GetName() == "prometheus_http_client_requests_total" {
+			for _, m := range mf.GetMetric() {
+				total += m.GetCounter().GetValue()
+			}
+		}
+	}
+	if total != 1 {
+		t.Errorf("app http client requests total %v", total)
+	}
+}
+
+func TestAppPrometheusDashboard(t *testing.T) {
+	base := &http.Client{}
+	app := &App{Config: &Config{ServiceName: "test"}, httpBase: base, httpRetry: base, HTTP: base}
+	_, err := app.NewPrometheusDashboard("")
+	if err != ErrPrometheusNotParsed {
+		t.Errorf("app dashboard before parse error %v", err)
+	}
+
+	err = app.NewParsePrometheusFunc()(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = app.NewPrometheusDashboard("")
+	if err != nil {
+		t.Errorf("app dashboard error %v", err)
+	}
+}
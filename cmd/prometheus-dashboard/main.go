@@ -0,0 +1,67 @@
+// prometheus-dashboard 命令读取服务/metrics监控项，生成Grafana dashboard json输出到stdout。
+//
+//	prometheus-dashboard -url http://127.0.0.1:8088/metrics -service endpoint -datasource prometheus > dashboard.json
+//
+// namespace和subsystem需要和服务prometheus配置相同。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/eudore/endpoint/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func main() {
+	url := flag.String("url", "http://127.0.0.1:8088/metrics", "service metrics url.")
+	service := flag.String("service", "", "service name used by $service variable.")
+	datasource := flag.String("datasource", "prometheus", "grafana prometheus datasource.")
+	title := flag.String("title", "", "dashboard title, default service name.")
+	namespace := flag.String("namespace", "prometheus", "endpoint metrics namespace.")
+	subsystem := flag.String("subsystem", "", "endpoint metrics subsystem.")
+	flag.Parse()
+
+	body, err := newDashboard(*url, &prometheus.DashboardConfig{
+		Title:      *title,
+		Service:    *service,
+		Datasource: *datasource,
+		Namespace:  *namespace,
+		Subsystem:  *subsystem,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "generate dashboard error: %s\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(body)
+}
+
+func newDashboard(url string, config *prometheus.DashboardConfig) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", string(expfmt.FmtText))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metrics url response status %d", resp.StatusCode)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	mfs := make([]*dto.MetricFamily, 0, len(families))
+	for _, mf := range families {
+		mfs = append(mfs, mf)
+	}
+	return prometheus.NewDashboard(config, mfs)
+}
@@ -0,0 +1,90 @@
+// tracer-replay 命令读取tracer写入的span文件，转换成OTLP/JSON格式输出或发送到collector。
+//
+//	tracer-replay -url http://127.0.0.1:4318/v1/traces spans.log spans-20220102150405.000.log
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/eudore/endpoint/tracer"
+)
+
+func main() {
+	url := flag.String("url", "", "OTLP http traces url, empty output to stdout.")
+	batch := flag.Int("batch", 500, "number of spans per request.")
+	flag.Parse()
+
+	for _, name := range flag.Args() {
+		err := replayFile(name, *url, *batch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "replay file %s error: %s\n", name, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func replayFile(name, url string, batch int) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var spans []*tracer.SpanData
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		span := &tracer.SpanData{}
+		err = json.Unmarshal(scanner.Bytes(), span)
+		if err != nil {
+			return err
+		}
+		spans = append(spans, span)
+		if len(spans) >= batch {
+			err = replaySpans(spans, url)
+			if err != nil {
+				return err
+			}
+			spans = spans[:0]
+		}
+	}
+	if scanner.Err() != nil {
+		return scanner.Err()
+	}
+	if len(spans) > 0 {
+		return replaySpans(spans, url)
+	}
+	return nil
+}
+
+func replaySpans(spans []*tracer.SpanData, url string) error {
+	body, err := tracer.NewSpanDataOTLP(spans)
+	if err != nil {
+		return err
+	}
+	if url == "" {
+		_, err = os.Stdout.Write(append(body, '\n'))
+		return err
+	}
+
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector response status %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
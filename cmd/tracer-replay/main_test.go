@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const replaySpanLines = `{"traceID":"1","spanID":"a","operationName":"GET /","startTime":1000,"duration":10,"tags":[{"key":"span.kind","type":"string","value":"server"}],"process":{"serviceName":"api"}}
+
+{"traceID":"1","spanID":"b","operationName":"select","startTime":1001,"duration":5,"references":[{"refType":"CHILD_OF","traceID":"1","spanID":"a"}],"process":{"serviceName":"db"}}
+{"traceID":"2","spanID":"c","operationName":"GET /users","startTime":2000,"duration":10,"process":{"serviceName":"api"}}
+`
+
+func newReplayFile(t *testing.T, body string) string {
+	name := filepath.Join(t.TempDir(), "spans.log")
+	err := os.WriteFile(name, []byte(body), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestReplayFile(t *testing.T) {
+	var batches []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []struct {
+						TraceID      string `json:"traceId"`
+						ParentSpanID string `json:"parentSpanId"`
+					} `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("replay request %s error %v", r.Header.Get("Content-Type"), err)
+		}
+		var n int
+		for _, res := range body.ResourceSpans {
+			for _, scope := range res.ScopeSpans {
+				for _, span := range scope.Spans {
+					if len(span.TraceID) != 32 || (span.ParentSpanID != "" && len(span.ParentSpanID) != 16) {
+						t.Errorf("replay span id %+v", span)
+					}
+					n++
+				}
+			}
+		}
+		batches = append(batches, n)
+	}))
+	defer srv.Close()
+
+	err := replayFile(newReplayFile(t, replaySpanLines), srv.URL, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 空行被忽略，按照batch分批发送。
+	if len(batches) != 2 || batches[0] != 2 || batches[1] != 1 {
+		t.Errorf("replay batches %v", batches)
+	}
+}
+
+func TestReplayFileError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		http.Error(w, "collector unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := replayFile(newReplayFile(t, replaySpanLines), srv.URL, 10)
+	if err == nil || !strings.Contains(err.Error(), "503") || !strings.Contains(err.Error(), "collector unavailable") {
+		t.Errorf("replay collector error %v", err)
+	}
+	err = replayFile(newReplayFile(t, "{invalid\n"), srv.URL, 10)
+	if err == nil {
+		t.Error("replay invalid line not error")
+	}
+	err = replayFile(filepath.Join(t.TempDir(), "none.log"), srv.URL, 10)
+	if !os.IsNotExist(err) {
+		t.Errorf("replay missing file error %v", err)
+	}
+}
@@ -1,11 +1,12 @@
 package endpoint
 
 import (
-	"context"
 	"io"
 	"net/http"
 
 	"github.com/eudore/endpoint/gorm"
+	"github.com/eudore/endpoint/prometheus"
+	"github.com/eudore/endpoint/tracer"
 	"github.com/eudore/eudore"
 	"github.com/opentracing/opentracing-go"
 )
@@ -38,14 +39,27 @@ func (ctx *Context) NewRequest(method, url string, body io.Reader) (*http.Reques
 	return req.WithContext(ctx.GetContext()), nil
 }
 
-// NewSpan 方法创建opentracing Span。
+// NewSpan 方法创建opentracing Span，请求不存在span时使用opentracing.GlobalTracer创建。
 func (ctx *Context) NewSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
-	span := opentracing.SpanFromContext(ctx.GetContext())
-	return span.Tracer().StartSpan(operationName, append(opts, opentracing.ChildOf(span.Context()))...)
+	return tracer.NewSpan(ctx.GetContext(), operationName, opts...)
+}
+
+// SetBaggage 方法设置请求span的baggage，使用tracing.baggage配置检查key和大小。
+func (ctx *Context) SetBaggage(key, val string) error {
+	return tracer.SetBaggage(ctx.GetContext(), &ctx.App.Config.Tracer.Baggage, key, val)
+}
+
+// GetBaggage 方法返回请求span的baggage。
+func (ctx *Context) GetBaggage(key string) string {
+	return tracer.GetBaggage(ctx.GetContext(), key)
+}
+
+// Metric 方法返回App.Metrics定义的业务监控项，记录数据时附加请求trace exemplar。
+func (ctx *Context) Metric(name string) prometheus.MetricContext {
+	return ctx.App.Metrics.Metric(ctx.GetContext(), name)
 }
 
 // WithDB 方法返回请求上下文的Database。
 func (ctx *Context) WithDB() *gorm.Database {
-	db := ctx.App.Database.WithContext(context.WithValue(ctx.GetContext(), gorm.ContextItemGormLogger, ctx.Logger()))
-	return db
+	return ctx.App.Database.WithContext(gorm.NewContext(ctx.App.Database, ctx.Context))
 }
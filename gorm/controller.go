@@ -24,11 +24,13 @@ type GormController struct {
 
 // NewGormController 函数创建gorm控制器。
 func NewGormController(db *gorm.DB, model interface{}) *GormController {
-	cols, typs, err := getGormModelColumns(db, model)
+	// 迁移和读取列信息不属于任何租户。
+	migrator := db.WithContext(WithoutTenant(context.Background()))
+	cols, typs, err := getGormModelColumns(migrator, model)
 	if err != nil {
 		return nil
 	}
-	db.AutoMigrate(model)
+	migrator.AutoMigrate(model)
 	name := getGormTableName(db, model)
 	db = db.Model(model)
 	return &GormController{
@@ -37,7 +39,7 @@ func NewGormController(db *gorm.DB, model interface{}) *GormController {
 		ModelColumnTypes: typs,
 		WithDB: func(ctx eudore.Context) *gorm.DB {
 			sql, vals := policy.CreateExpressions(ctx, name, cols, -1)
-			return db.Where(sql, vals...).WithContext(context.WithValue(ctx.GetContext(), ContextItemGormLogger, ctx.Logger()))
+			return db.Where(sql, vals...).WithContext(NewContext(db, ctx))
 		},
 	}
 }
@@ -1,10 +1,13 @@
 package gorm
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/eudore/eudore"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"gorm.io/gorm"
 )
 
@@ -15,7 +18,11 @@ type Database = gorm.DB
 type Config struct {
 	Dialector     func(string) gorm.Dialector `json:"-" alias:"-"`
 	Logger        eudore.Logger               `json:"-" alias:"-"`
+	Registerer    prometheus.Registerer       `json:"-" alias:"-"`
+	Fingerprints  int                         `json:"fingerprints" alias:"fingerprints"`
 	LoggerLevel   eudore.LoggerLevel          `json:"loggerlevel" alias:"loggerlevel"`
+	LoggerHeader  string                      `json:"loggerheader" alias:"loggerheader"`
+	LoggerPolicys []string                    `json:"loggerpolicys" alias:"loggerpolicys"`
 	SlowThreshold time.Duration               `json:"slowthreshold" alias:"slowthreshold"`
 	MaxIdle       int                         `json:"maxidle" alias:"maxidle"`
 	MaxOpen       int                         `json:"maxopen" alias:"maxopen"`
@@ -28,13 +35,51 @@ type Config struct {
 	Name          string                      `json:"name" alias:"name"`
 	Options       string                      `json:"options" alias:"options"`
 	Success       string                      `json:"success" alias:"success"`
+	SpanRedact    bool                        `json:"spanredact" alias:"spanredact"`
+	Tenant        TenantConfig                `json:"tenant" alias:"tenant"`
+}
+
+var dbSystemMapping = map[string]string{
+	"sqlite":   "sqlite",
+	"postgres": "postgresql",
+	"mysql":    "mysql",
+}
+
+// NewContext 函数创建gorm查询使用的context，附加请求logger、日志级别和租户。
+func NewContext(db *gorm.DB, ctx eudore.Context) context.Context {
+	c := context.WithValue(ctx.GetContext(), ContextItemGormLogger, ctx.Logger())
+	if logger, ok := db.Logger.(*gormLogger); ok {
+		c = logger.withContext(ctx, c)
+	}
+	plugin, ok := db.Config.Plugins[tenantPluginName].(tenantPlugin)
+	if ok {
+		tenant := plugin.getTenantFromRequest(ctx)
+		if tenant != "" {
+			c = WithTenant(c, tenant)
+		}
+	}
+	return c
 }
 
 // NewGorm 函数使用配置创建gorm实例。
 func NewGorm(config *Config) (db *gorm.DB, err error) {
-	ormconfig := &gorm.Config{
-		Logger: NewGromLogger(config.Logger, config.LoggerLevel, config.SlowThreshold),
+	logger := &gormLogger{
+		Logger:        config.Logger,
+		LogLevel:      config.LoggerLevel,
+		SlowThreshold: config.SlowThreshold,
+		LevelHeader:   config.LoggerHeader,
+		LevelPolicys:  config.LoggerPolicys,
+	}
+	if config.Registerer != nil {
+		if config.Fingerprints == 0 {
+			config.Fingerprints = 500
+		}
+		logger.Metrics, err = newGormMetrics(config.Registerer, config.Fingerprints)
+		if err != nil {
+			return nil, err
+		}
 	}
+	ormconfig := &gorm.Config{Logger: logger}
 	config.Type = eudore.GetString(config.Type, "sqlite")
 	switch config.Type {
 	case "sqlite":
@@ -68,6 +113,11 @@ func NewGorm(config *Config) (db *gorm.DB, err error) {
 		err = fmt.Errorf("endpoint init database error: %s", err.Error())
 		return nil, err
 	}
+	logger.System = dbSystemMapping[config.Type]
+	logger.Name = config.Name
+	logger.Host = config.Host
+	logger.Port = config.Port
+	logger.Redact = config.SpanRedact
 
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -76,5 +126,19 @@ func NewGorm(config *Config) (db *gorm.DB, err error) {
 	sqlDB.SetMaxIdleConns(3)
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(24 * time.Hour)
+	if config.Registerer != nil {
+		// 注册连接池状态监控项go_sql_*。
+		err = config.Registerer.Register(collectors.NewDBStatsCollector(sqlDB, eudore.GetString(config.Name, config.Type)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Tenant.Mode != "" {
+		err = db.Use(NewTenantPlugin(&config.Tenant))
+		if err != nil {
+			return nil, err
+		}
+	}
 	return db, nil
 }
@@ -2,12 +2,17 @@ package gorm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/eudore/eudore"
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/opentracing/opentracing-go/log"
+	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
 	gormutils "gorm.io/gorm/utils"
 )
@@ -19,10 +24,29 @@ type contextKey struct {
 // ContextItemGormLogger 定义gorm使用的eudore.Logger的context key。
 var ContextItemGormLogger = &contextKey{"logger"}
 
+// ContextItemGormLoggerLevel 定义gorm使用的请求日志级别的context key。
+var ContextItemGormLoggerLevel = &contextKey{"logger-level"}
+
+var loggerLevelMapping = map[string]eudore.LoggerLevel{
+	"debug":   eudore.LogDebug,
+	"info":    eudore.LogInfo,
+	"warning": eudore.LogWarning,
+	"error":   eudore.LogError,
+	"fatal":   eudore.LogFatal,
+}
+
 type gormLogger struct {
 	Logger        eudore.Logger
 	LogLevel      eudore.LoggerLevel
 	SlowThreshold time.Duration
+	LevelHeader   string
+	LevelPolicys  []string
+	Metrics       *gormMetrics
+	System        string
+	Name          string
+	Host          string
+	Port          string
+	Redact        bool
 }
 
 // NewGromLogger 函数适配eudore.Logger实现gormlogger接口。
@@ -34,14 +58,34 @@ func NewGromLogger(logger eudore.Logger, level eudore.LoggerLevel, slow time.Dur
 	}
 }
 
+// withContext 方法读取请求header设置的日志级别，仅LevelPolicys允许的请求生效。
+func (l gormLogger) withContext(ctx eudore.Context, c context.Context) context.Context {
+	if l.LevelHeader == "" {
+		return c
+	}
+	level, ok := loggerLevelMapping[strings.ToLower(ctx.GetHeader(l.LevelHeader))]
+	if ok && stringSliceIn(l.LevelPolicys, ctx.GetParam("Policy")) {
+		return context.WithValue(c, ContextItemGormLoggerLevel, level)
+	}
+	return c
+}
+
 func (l gormLogger) getLogger(ctx context.Context) eudore.Logger {
-	log, ok := ctx.Value("logger").(eudore.Logger)
+	log, ok := ctx.Value(ContextItemGormLogger).(eudore.Logger)
 	if ok {
 		return log
 	}
 	return l.Logger
 }
 
+func (l gormLogger) getLevel(ctx context.Context) eudore.LoggerLevel {
+	level, ok := ctx.Value(ContextItemGormLoggerLevel).(eudore.LoggerLevel)
+	if ok {
+		return level
+	}
+	return l.LogLevel
+}
+
 var levelMapping = map[gormlogger.LogLevel]eudore.LoggerLevel{
 	gormlogger.Silent: eudore.LogFatal,
 	gormlogger.Error:  eudore.LogError,
@@ -60,55 +104,102 @@ func (l *gormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
 }
 
 func (l gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
-	if l.LogLevel >= eudore.LogInfo {
+	if l.getLevel(ctx) >= eudore.LogInfo {
 		l.getLogger(ctx).Infof(msg, data...)
 	}
 }
 
 func (l gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
-	if l.LogLevel >= eudore.LogWarning {
+	if l.getLevel(ctx) >= eudore.LogWarning {
 		l.getLogger(ctx).Warningf(msg, data...)
 	}
 }
 
 func (l gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
-	if l.LogLevel >= eudore.LogError {
+	if l.getLevel(ctx) >= eudore.LogError {
 		l.getLogger(ctx).Errorf(msg, data...)
 	}
 }
 
 func (l gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
 	sql, rows := fc()
-	if l.LogLevel < eudore.LogFatal {
+	if l.Metrics != nil {
+		l.Metrics.Observe(sql, time.Since(begin), rows, err)
+	}
+	file := gormutils.FileWithLineNum()
+	level := l.getLevel(ctx)
+	if level < eudore.LogFatal {
 		elapsed := time.Since(begin)
 		log := l.getLogger(ctx).WithFields([]string{"sqltime", "sql", "file"},
-			[]interface{}{fmt.Sprintf("%.3fms", float64(elapsed.Nanoseconds())/1e6), sql, gormutils.FileWithLineNum()})
+			[]interface{}{fmt.Sprintf("%.3fms", float64(elapsed.Nanoseconds())/1e6), sql, file})
 		if rows != -1 {
-			log.WithField("rows", rows)
+			log = log.WithField("rows", rows)
 		}
 		switch {
-		case err != nil && l.LogLevel >= eudore.LogError:
+		case err != nil && level >= eudore.LogError:
 			log.Error(err.Error())
-		case elapsed > l.SlowThreshold && l.SlowThreshold != 0 && l.LogLevel >= eudore.LogWarning:
+		case elapsed > l.SlowThreshold && l.SlowThreshold != 0 && level >= eudore.LogWarning:
 			log.Warningf("SLOW SQL >= %v", l.SlowThreshold)
-		case l.LogLevel <= eudore.LogInfo:
+		case level <= eudore.LogInfo:
 			log.Info()
 		}
 	}
 
 	spanParent := opentracing.SpanFromContext(ctx)
 	if spanParent != nil {
-		span := spanParent.Tracer().StartSpan(
-			"gorm",
-			opentracing.StartTime(begin),
-			opentracing.ChildOf(spanParent.Context()),
-			opentracing.Tags{"span.kind": "client"},
-		)
-		span.LogFields(log.Int64("rows", rows))
-		span.LogFields(log.String("sql", sql))
-		if err != nil {
-			span.LogFields(log.String("error", err.Error()))
+		l.traceSpan(spanParent, begin, sql, rows, file, err)
+	}
+}
+
+// traceSpan 方法创建sql span，span名称和tags遵循OpenTelemetry数据库语义约定。
+func (l gormLogger) traceSpan(parent opentracing.Span, begin time.Time, sql string, rows int64, file string, err error) {
+	operation, table := getSQLOperation(sql), getSQLTable(sql)
+	name := "gorm"
+	if operation != "other" {
+		name = strings.ToUpper(operation)
+		if table != "" {
+			name += " " + table
+		}
+	}
+	statement := sql
+	if l.Redact {
+		statement = getSQLNormalize(sql)
+	}
+	tags := opentracing.Tags{
+		"span.kind":    "client",
+		"db.system":    l.System,
+		"db.name":      l.Name,
+		"db.statement": statement,
+		"db.operation": strings.ToUpper(operation),
+	}
+	if table != "" {
+		tags["db.sql.table"] = table
+	}
+	if l.System != "sqlite" {
+		tags["net.peer.name"] = l.Host
+		if port, err := strconv.Atoi(l.Port); err == nil {
+			tags["net.peer.port"] = port
+		}
+	}
+	if pos := strings.LastIndexByte(file, ':'); pos != -1 {
+		tags["code.filepath"] = file[:pos]
+		if line, err := strconv.Atoi(file[pos+1:]); err == nil {
+			tags["code.lineno"] = line
 		}
-		span.Finish()
 	}
+	if rows != -1 {
+		tags["db.rows"] = rows
+	}
+
+	span := parent.Tracer().StartSpan(
+		name,
+		opentracing.StartTime(begin),
+		opentracing.ChildOf(parent.Context()),
+		tags,
+	)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("event", "error"), log.String("message", err.Error()))
+	}
+	span.Finish()
 }
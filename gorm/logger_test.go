@@ -0,0 +1,98 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eudore/endpoint/tracer"
+	"github.com/eudore/eudore"
+	"github.com/opentracing/opentracing-go"
+	"gorm.io/gorm"
+)
+
+func newTestGormLogger() *gormLogger {
+	return &gormLogger{
+		LogLevel: eudore.LogFatal,
+		System:   "mysql",
+		Name:     "endpoint",
+		Host:     "127.0.0.1",
+		Port:     "3306",
+	}
+}
+
+func TestGormLoggerTrace(t *testing.T) {
+	mock := tracer.NewMockTracer()
+	parent := mock.StartSpan("parent")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+
+	logger := newTestGormLogger()
+	logger.Trace(ctx, time.Now(), func() (string, int64) {
+		return "SELECT * FROM `users` WHERE id = 1", 1
+	}, nil)
+	logger.Trace(ctx, time.Now(), func() (string, int64) {
+		return "UPDATE `users` SET name = 'a'", -1
+	}, errors.New("deadlock"))
+	logger.Trace(ctx, time.Now(), func() (string, int64) {
+		return "SELECT * FROM `users` WHERE id = 2", 0
+	}, gorm.ErrRecordNotFound)
+	parent.Finish()
+
+	spans := tracer.GetMockSpans(mock, "SELECT users")
+	if len(spans) != 2 {
+		t.Fatalf("SELECT users spans %d", len(spans))
+	}
+	for _, span := range spans {
+		if !tracer.IsMockChildOf(span, tracer.GetMockSpans(mock, "parent")[0]) {
+			t.Error("gorm span is not child of parent")
+		}
+		if span.Tag("error") != nil {
+			t.Error("gorm record not found set error tag")
+		}
+	}
+	for key, val := range map[string]interface{}{
+		"span.kind":     "client",
+		"db.system":     "mysql",
+		"db.name":       "endpoint",
+		"db.operation":  "SELECT",
+		"db.sql.table":  "users",
+		"db.statement":  "SELECT * FROM `users` WHERE id = 1",
+		"db.rows":       1,
+		"net.peer.name": "127.0.0.1",
+		"net.peer.port": 3306,
+	} {
+		if !tracer.HasMockTag(spans[0], key, val) {
+			t.Errorf("gorm span tag %s=%v, got %v", key, val, spans[0].Tag(key))
+		}
+	}
+
+	spans = tracer.GetMockSpans(mock, "UPDATE users")
+	if len(spans) != 1 {
+		t.Fatalf("UPDATE users spans %d", len(spans))
+	}
+	if !tracer.HasMockTag(spans[0], "error", true) || !tracer.HasMockLog(spans[0], "message", "deadlock") {
+		t.Error("gorm span not record error")
+	}
+}
+
+func TestGormLoggerTraceRedact(t *testing.T) {
+	mock := tracer.NewMockTracer()
+	parent := mock.StartSpan("parent")
+	logger := newTestGormLogger()
+	logger.Redact = true
+	logger.Trace(opentracing.ContextWithSpan(context.Background(), parent), time.Now(), func() (string, int64) {
+		return "SELECT * FROM `users` WHERE name = 'secret'", 1
+	}, nil)
+
+	spans := tracer.GetMockSpans(mock, "SELECT users")
+	if len(spans) != 1 || spans[0].Tag("db.statement") == "SELECT * FROM `users` WHERE name = 'secret'" {
+		t.Fatalf("gorm span not redact statement: %v", spans)
+	}
+}
+
+func TestGormLoggerTraceNoSpan(t *testing.T) {
+	newTestGormLogger().Trace(context.Background(), time.Now(), func() (string, int64) {
+		return "SELECT 1", 1
+	}, nil)
+}
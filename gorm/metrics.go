@@ -0,0 +1,88 @@
+package gorm
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+var (
+	// GormDurationName 定义sql耗时的监控项名称
+	GormDurationName = "gorm_query_duration_seconds"
+	// GormDurationHelp 定义sql耗时的监控项名称
+	GormDurationHelp = "Histogram of latencies for SQL queries."
+	// GormRowsName 定义sql影响行数的监控项名称
+	GormRowsName = "gorm_query_rows_total"
+	// GormRowsHelp 定义sql影响行数的监控项名称
+	GormRowsHelp = "Total number of rows affected or returned by SQL queries."
+	// GormErrorsName 定义sql错误的监控项名称
+	GormErrorsName = "gorm_query_errors_total"
+	// GormErrorsHelp 定义sql错误的监控项名称
+	GormErrorsHelp = "Total number of failed SQL queries."
+	// GormFingerprintOverflow 定义超出指纹数量限制后使用的指纹值。
+	GormFingerprintOverflow = "other"
+)
+
+type gormMetrics struct {
+	sync.RWMutex
+	Duration     *prometheus.HistogramVec
+	Rows         *prometheus.CounterVec
+	Errors       *prometheus.CounterVec
+	Fingerprints map[string]struct{}
+	Limit        int
+}
+
+// newGormMetrics 函数创建sql监控项，limit限制fingerprint标签的数量。
+func newGormMetrics(reg prometheus.Registerer, limit int) (*gormMetrics, error) {
+	labels := []string{"operation", "table", "fingerprint"}
+	metrics := &gormMetrics{
+		Duration:     prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: GormDurationName, Help: GormDurationHelp}, labels),
+		Rows:         prometheus.NewCounterVec(prometheus.CounterOpts{Name: GormRowsName, Help: GormRowsHelp}, labels),
+		Errors:       prometheus.NewCounterVec(prometheus.CounterOpts{Name: GormErrorsName, Help: GormErrorsHelp}, labels),
+		Fingerprints: make(map[string]struct{}),
+		Limit:        limit,
+	}
+	for _, c := range []prometheus.Collector{metrics.Duration, metrics.Rows, metrics.Errors} {
+		err := reg.Register(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return metrics, nil
+}
+
+func (m *gormMetrics) getFingerprint(sql string) string {
+	fingerprint := getSQLFingerprint(sql)
+	m.RLock()
+	_, ok := m.Fingerprints[fingerprint]
+	m.RUnlock()
+	if ok {
+		return fingerprint
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if len(m.Fingerprints) >= m.Limit {
+		return GormFingerprintOverflow
+	}
+	m.Fingerprints[fingerprint] = struct{}{}
+	return fingerprint
+}
+
+func (m *gormMetrics) Observe(sql string, elapsed time.Duration, rows int64, err error) {
+	labels := prometheus.Labels{
+		"operation":   getSQLOperation(sql),
+		"table":       getSQLTable(sql),
+		"fingerprint": m.getFingerprint(sql),
+	}
+	m.Duration.With(labels).Observe(elapsed.Seconds())
+	if rows > 0 {
+		m.Rows.With(labels).Add(float64(rows))
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		m.Errors.With(labels).Inc()
+	}
+}
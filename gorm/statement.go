@@ -0,0 +1,55 @@
+package gorm
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+var (
+	regSQLString = regexp.MustCompile(`'(?:[^']|'')*'`)
+	regSQLNumber = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	regSQLList   = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+	regSQLSpace  = regexp.MustCompile(`\s+`)
+	regSQLTable  = regexp.MustCompile("(?i)\\b(?:from|into|update|join)\\s+([\\w.\"`]+)")
+)
+
+// getSQLOperation 函数返回sql语句的操作类型。
+func getSQLOperation(sql string) string {
+	sql = strings.TrimLeft(sql, " \t\r\n(")
+	pos := strings.IndexAny(sql, " \t\r\n")
+	if pos != -1 {
+		sql = sql[:pos]
+	}
+	switch op := strings.ToLower(sql); op {
+	case "select", "insert", "update", "delete":
+		return op
+	default:
+		return "other"
+	}
+}
+
+// getSQLTable 函数返回sql语句操作的第一个表名。
+func getSQLTable(sql string) string {
+	match := regSQLTable.FindStringSubmatch(sql)
+	if match == nil {
+		return ""
+	}
+	return strings.NewReplacer("\"", "", "`", "").Replace(match[1])
+}
+
+// getSQLNormalize 函数将sql语句中的字面值替换为'?'，并合并IN列表和空白。
+func getSQLNormalize(sql string) string {
+	sql = regSQLString.ReplaceAllString(sql, "?")
+	sql = regSQLNumber.ReplaceAllString(sql, "?")
+	sql = regSQLList.ReplaceAllString(sql, "(?)")
+	return strings.TrimSpace(regSQLSpace.ReplaceAllString(sql, " "))
+}
+
+// getSQLFingerprint 函数返回标准化sql语句的指纹。
+func getSQLFingerprint(sql string) string {
+	h := fnv.New64a()
+	h.Write([]byte(strings.ToLower(getSQLNormalize(sql))))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
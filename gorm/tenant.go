@@ -0,0 +1,226 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/eudore/eudore"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ContextItemGormTenant 定义gorm使用的租户的context key。
+var ContextItemGormTenant = &contextKey{"tenant"}
+
+var contextItemGormTenantSkip = &contextKey{"tenant-skip"}
+
+// ErrTenantRequired 定义租户为空或语句无法附加租户隔离时的错误。
+var ErrTenantRequired = errors.New("endpoint gorm tenant is required")
+
+var (
+	regTenantColumn = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+	regTenantSchema = regexp.MustCompile(`^[A-Za-z0-9_]{1,63}$`)
+)
+
+const tenantPluginName = "endpoint:tenant"
+
+// TenantConfig 定义多租户配置。
+//
+// Mode为column时查询自动附加租户列条件，创建时自动填充租户列；
+// Mode为schema时(仅postgres)将表名加上租户schema前缀。
+//
+// Source定义租户来源：header读取Name请求header，host读取子域名，
+// param读取Name请求参数(例如policy中间件写入的用户属性)。
+// header和host由客户端控制，需要网关或中间件校验租户归属。
+//
+// 默认没有租户时返回ErrTenantRequired，Optional为true时没有租户不隔离；
+// 跨租户任务(包括迁移)需要使用WithoutTenant创建的context。
+type TenantConfig struct {
+	Mode     string `json:"mode" alias:"mode"`
+	Source   string `json:"source" alias:"source"`
+	Name     string `json:"name" alias:"name"`
+	Column   string `json:"column" alias:"column"`
+	Optional bool   `json:"optional" alias:"optional"`
+}
+
+type tenantPlugin struct {
+	*TenantConfig
+}
+
+// NewTenantPlugin 函数创建多租户gorm插件。
+func NewTenantPlugin(config *TenantConfig) gorm.Plugin {
+	config.Mode = eudore.GetString(config.Mode, "column")
+	config.Source = eudore.GetString(config.Source, "header")
+	config.Name = eudore.GetString(config.Name, "X-Tenant-Id")
+	config.Column = eudore.GetString(config.Column, "tenant_id")
+	return tenantPlugin{config}
+}
+
+// WithTenant 函数返回附加租户的context，使用该context的查询自动隔离租户数据。
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, ContextItemGormTenant, tenant)
+}
+
+// WithoutTenant 函数返回跳过租户隔离的context，用于跨租户的管理任务。
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextItemGormTenantSkip, true)
+}
+
+func (p tenantPlugin) Name() string {
+	return tenantPluginName
+}
+
+func (p tenantPlugin) Initialize(db *gorm.DB) error {
+	if p.Mode != "column" && p.Mode != "schema" {
+		return fmt.Errorf("未定义租户模式：'%s'", p.Mode)
+	}
+	if p.Mode == "schema" && db.Dialector.Name() != "postgres" {
+		return fmt.Errorf("租户schema模式不支持db类型：'%s'", db.Dialector.Name())
+	}
+
+	callback := db.Callback()
+	errs := []error{
+		callback.Create().Before("gorm:create").Register(tenantPluginName, p.handleCreate),
+		callback.Query().Before("gorm:query").Register(tenantPluginName, p.handleScope),
+		callback.Update().Before("gorm:update").Register(tenantPluginName, p.handleWrite),
+		callback.Delete().Before("gorm:delete").Register(tenantPluginName, p.handleWrite),
+		callback.Row().Before("gorm:row").Register(tenantPluginName, p.handleScope),
+		callback.Raw().Before("gorm:raw").Register(tenantPluginName, p.handleScope),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p tenantPlugin) getTenantFromRequest(ctx eudore.Context) string {
+	switch p.Source {
+	case "host":
+		host := ctx.Request().Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		pos := strings.IndexByte(host, '.')
+		if pos == -1 || net.ParseIP(host) != nil {
+			return ""
+		}
+		return host[:pos]
+	case "param":
+		return ctx.GetParam(p.TenantConfig.Name)
+	default:
+		return ctx.GetHeader(p.TenantConfig.Name)
+	}
+}
+
+func (p tenantPlugin) getTenant(db *gorm.DB) (string, bool) {
+	if db.Error != nil {
+		return "", false
+	}
+	ctx := db.Statement.Context
+	if skip, _ := ctx.Value(contextItemGormTenantSkip).(bool); skip {
+		return "", false
+	}
+	tenant, _ := ctx.Value(ContextItemGormTenant).(string)
+	switch {
+	case tenant == "" && p.Optional:
+		return "", false
+	case tenant == "":
+		db.AddError(ErrTenantRequired)
+		return "", false
+	case db.Statement.Schema == nil || db.Statement.SQL.Len() > 0:
+		// Raw、Exec和没有model的语句无法附加租户条件。
+		db.AddError(fmt.Errorf("%w: statement without model or with raw sql", ErrTenantRequired))
+		return "", false
+	case p.Mode == "column" && !regTenantColumn.MatchString(tenant):
+		db.AddError(fmt.Errorf("endpoint gorm tenant '%s' is invalid", tenant))
+		return "", false
+	case p.Mode == "schema" && !regTenantSchema.MatchString(tenant):
+		db.AddError(fmt.Errorf("endpoint gorm tenant '%s' is invalid schema name", tenant))
+		return "", false
+	}
+	return tenant, true
+}
+
+func (p tenantPlugin) handleScope(db *gorm.DB) {
+	tenant, ok := p.getTenant(db)
+	if ok {
+		p.scope(db, tenant)
+	}
+}
+
+func (p tenantPlugin) scope(db *gorm.DB, tenant string) {
+	switch p.Mode {
+	case "column":
+		if db.Statement.Schema.LookUpField(p.Column) != nil {
+			db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+				clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: p.Column}, Value: tenant},
+			}})
+		}
+	case "schema":
+		if !strings.Contains(db.Statement.Table, ".") {
+			db.Statement.Table = tenant + "." + db.Statement.Table
+		}
+	}
+}
+
+// handleWrite 方法处理update和delete，没有条件时返回gorm.ErrMissingWhereClause，
+// 避免租户条件使无条件更新或删除作用于租户全部数据。
+func (p tenantPlugin) handleWrite(db *gorm.DB) {
+	tenant, ok := p.getTenant(db)
+	if !ok {
+		return
+	}
+	if p.Mode == "column" && !hasWhereClause(db) {
+		db.AddError(gorm.ErrMissingWhereClause)
+		return
+	}
+	p.scope(db, tenant)
+}
+
+// hasWhereClause 函数检查update和delete是否存在条件，包含gorm使用主键生成的条件。
+func hasWhereClause(db *gorm.DB) bool {
+	if _, ok := db.Statement.Clauses["WHERE"]; ok || db.AllowGlobalUpdate {
+		return true
+	}
+	fields := db.Statement.Schema.PrimaryFields
+	if _, vals := schema.GetIdentityFieldValuesMap(db.Statement.ReflectValue, fields); len(vals) > 0 {
+		return true
+	}
+	if db.Statement.Model != nil {
+		_, vals := schema.GetIdentityFieldValuesMap(reflect.ValueOf(db.Statement.Model), fields)
+		return len(vals) > 0
+	}
+	return false
+}
+
+func (p tenantPlugin) handleCreate(db *gorm.DB) {
+	tenant, ok := p.getTenant(db)
+	if !ok {
+		return
+	}
+	if p.Mode == "schema" {
+		p.scope(db, tenant)
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField(p.Column)
+	if field == nil {
+		return
+	}
+	switch val := db.Statement.ReflectValue; val.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			db.AddError(field.Set(reflect.Indirect(val.Index(i)), tenant))
+		}
+	case reflect.Struct:
+		db.AddError(field.Set(val, tenant))
+	}
+}
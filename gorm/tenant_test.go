@@ -0,0 +1,136 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils/tests"
+)
+
+type tenantDialector struct {
+	tests.DummyDialector
+}
+
+func (tenantDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	return nil
+}
+
+type tenantUser struct {
+	ID       uint
+	Name     string
+	TenantID string
+}
+
+func newTestTenantDB(t *testing.T, config *TenantConfig) *gorm.DB {
+	db, err := gorm.Open(tenantDialector{}, &gorm.Config{DryRun: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Use(NewTenantPlugin(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestTenantColumn(t *testing.T) {
+	db := newTestTenantDB(t, &TenantConfig{})
+	tenant := db.WithContext(WithTenant(context.Background(), "t1"))
+
+	var users []tenantUser
+	stmt := tenant.Where("name = ?", "a").Find(&users).Statement
+	if stmt.Error != nil {
+		t.Fatal(stmt.Error)
+	}
+	if sql := stmt.SQL.String(); !strings.Contains(sql, "`tenant_users`.`tenant_id` = ?") {
+		t.Errorf("select sql %s", sql)
+	}
+	if len(stmt.Vars) != 2 || stmt.Vars[1] != "t1" {
+		t.Errorf("select vars %v", stmt.Vars)
+	}
+
+	stmt = tenant.Model(&tenantUser{}).Where("name = ?", "a").Update("name", "b").Statement
+	if stmt.Error != nil || !strings.Contains(stmt.SQL.String(), "`tenant_users`.`tenant_id` = ?") {
+		t.Errorf("update sql %s %v", stmt.SQL.String(), stmt.Error)
+	}
+	stmt = tenant.Delete(&tenantUser{ID: 1}).Statement
+	if stmt.Error != nil || !strings.Contains(stmt.SQL.String(), "`tenant_users`.`tenant_id` = ?") {
+		t.Errorf("delete sql %s %v", stmt.SQL.String(), stmt.Error)
+	}
+
+	err := tenant.Model(&tenantUser{}).Update("name", "b").Error
+	if !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Errorf("update without where error %v", err)
+	}
+	err = tenant.Delete(&tenantUser{}).Error
+	if !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Errorf("delete without where error %v", err)
+	}
+
+	created := []tenantUser{{Name: "a"}, {Name: "b", TenantID: "t2"}}
+	err = tenant.Create(&created).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range created {
+		if user.TenantID != "t1" {
+			t.Errorf("create tenant %s", user.TenantID)
+		}
+	}
+}
+
+func TestTenantRequired(t *testing.T) {
+	db := newTestTenantDB(t, &TenantConfig{})
+	var users []tenantUser
+	var rows []map[string]interface{}
+	for name, err := range map[string]error{
+		"select": db.Find(&users).Error,
+		"create": db.Create(&tenantUser{Name: "a"}).Error,
+		"update": db.Model(&tenantUser{}).Where("id = 1").Update("name", "b").Error,
+		"delete": db.Where("id = 1").Delete(&tenantUser{}).Error,
+		"raw":    db.WithContext(WithTenant(context.Background(), "t1")).Raw("SELECT * FROM tenant_users").Scan(&users).Error,
+		"exec":   db.WithContext(WithTenant(context.Background(), "t1")).Exec("DELETE FROM tenant_users").Error,
+		"table":  db.WithContext(WithTenant(context.Background(), "t1")).Table("tenant_users").Find(&rows).Error,
+	} {
+		if !errors.Is(err, ErrTenantRequired) {
+			t.Errorf("%s error %v", name, err)
+		}
+	}
+
+	err := db.WithContext(WithTenant(context.Background(), "t1' OR '1'='1")).Find(&users).Error
+	if err == nil {
+		t.Error("invalid tenant not rejected")
+	}
+
+	optional := newTestTenantDB(t, &TenantConfig{Optional: true})
+	stmt := optional.Find(&users).Statement
+	if stmt.Error != nil || strings.Contains(stmt.SQL.String(), "tenant_id") {
+		t.Errorf("optional sql %s %v", stmt.SQL.String(), stmt.Error)
+	}
+}
+
+func TestTenantSkip(t *testing.T) {
+	db := newTestTenantDB(t, &TenantConfig{})
+	skip := db.WithContext(WithoutTenant(WithTenant(context.Background(), "t1")))
+
+	var users []tenantUser
+	stmt := skip.Find(&users).Statement
+	if stmt.Error != nil || strings.Contains(stmt.SQL.String(), "tenant_id") {
+		t.Errorf("skip sql %s %v", stmt.SQL.String(), stmt.Error)
+	}
+	err := skip.Exec("DELETE FROM tenant_users").Error
+	if err != nil {
+		t.Errorf("skip exec error %v", err)
+	}
+	user := &tenantUser{Name: "a"}
+	err = skip.Create(user).Error
+	if err != nil || user.TenantID != "" {
+		t.Errorf("skip create %s %v", user.TenantID, err)
+	}
+}
@@ -0,0 +1,180 @@
+package prometheus
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eudore/eudore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// PrometheusClientInflightName 定义当前http客户端请求的监控项名称
+	PrometheusClientInflightName = "http_client_requests_in_flight"
+	// PrometheusClientInflightHelp 定义当前http客户端请求的监控项名称
+	PrometheusClientInflightHelp = "Current number of outbound HTTP requests being served."
+	// PrometheusClientCountName 定义http客户端总请求的监控项名称
+	PrometheusClientCountName = "http_client_requests_total"
+	// PrometheusClientCountHelp 定义http客户端总请求的监控项名称
+	PrometheusClientCountHelp = "Total number of outbound HTTP requests by status class."
+	// PrometheusClientDurationName 定义http客户端请求耗时的监控项名称
+	PrometheusClientDurationName = "http_client_request_duration_seconds"
+	// PrometheusClientDurationHelp 定义http客户端请求耗时的监控项名称
+	PrometheusClientDurationHelp = "Histogram of latencies for outbound HTTP requests."
+	// PrometheusClientErrorsName 定义http客户端请求错误的监控项名称
+	PrometheusClientErrorsName = "http_client_errors_total"
+	// PrometheusClientErrorsHelp 定义http客户端请求错误的监控项名称
+	PrometheusClientErrorsHelp = "Total number of outbound HTTP requests failed without response."
+	// PrometheusClientTraceName 定义http客户端连接阶段耗时的监控项名称
+	PrometheusClientTraceName = "http_client_trace_duration_seconds"
+	// PrometheusClientTraceHelp 定义http客户端连接阶段耗时的监控项名称
+	PrometheusClientTraceHelp = "Histogram of dns, connect, tls and first byte latencies for outbound HTTP requests."
+)
+
+type httpMetrics struct {
+	next     http.RoundTripper
+	series   *seriesLimiter
+	inflight *prometheus.GaugeVec
+	count    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	trace    *prometheus.HistogramVec
+}
+
+// httpClientTrace 定义一次请求的连接阶段时间，并发连接使用锁保护。
+type httpClientTrace struct {
+	sync.Mutex
+	host     string
+	start    time.Time
+	dns      time.Time
+	connects map[string]time.Time
+	tls      time.Time
+	observer *prometheus.HistogramVec
+}
+
+// NewPrometheusHTTPClient 函数复制http.Client并设置Transport记录prometheus监控项，不修改原client。
+//
+// host标签优先使用X-Service-Id请求header，否则使用请求host，host数量超过MaxSeries后使用PrometheusOverflowValue。
+func NewPrometheusHTTPClient(client *http.Client, reg prometheus.Registerer, config *Config) *http.Client {
+	c := *client
+	if c.Transport == nil {
+		c.Transport = http.DefaultTransport
+	}
+	if config.MaxSeries == 0 {
+		config.MaxSeries = 1000
+	}
+	config.Namespace = eudore.GetString(config.Namespace, "prometheus")
+	labels := []string{"host", "method", "code"}
+	metrics := httpMetrics{
+		next:   c.Transport,
+		series: newSeriesLimiter(config.MaxSeries),
+		inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: PrometheusClientInflightName, Help: PrometheusClientInflightHelp,
+		}, labels[:2]),
+		count: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: PrometheusClientCountName, Help: PrometheusClientCountHelp,
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: PrometheusClientDurationName, Help: PrometheusClientDurationHelp,
+			Buckets: config.DurationBuckets, NativeHistogramBucketFactor: config.NativeHistogramFactor,
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: PrometheusClientErrorsName, Help: PrometheusClientErrorsHelp,
+		}, labels[:2]),
+		trace: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: PrometheusClientTraceName, Help: PrometheusClientTraceHelp,
+			Buckets: config.DurationBuckets, NativeHistogramBucketFactor: config.NativeHistogramFactor,
+		}, []string{"host", "event"}),
+	}
+	reg.MustRegister(metrics.inflight, metrics.count, metrics.duration, metrics.errors, metrics.trace)
+	c.Transport = metrics
+	return &c
+}
+
+func (m httpMetrics) RoundTripper() http.RoundTripper {
+	return m.next
+}
+
+func (m httpMetrics) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.Header.Get("X-Service-Id")
+	if host == "" {
+		host = req.URL.Host
+	}
+	if !m.series.Allow([]string{host}) {
+		host = PrometheusOverflowValue
+	}
+	inflight := m.inflight.WithLabelValues(host, req.Method)
+	inflight.Inc()
+	defer inflight.Dec()
+
+	trace := &httpClientTrace{host: host, start: time.Now(), observer: m.trace}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.newClientTrace()))
+	resp, err := m.next.RoundTrip(req)
+	code := "error"
+	if err != nil {
+		m.errors.WithLabelValues(host, req.Method).Inc()
+	} else {
+		code = strconv.Itoa(resp.StatusCode/100) + "xx"
+	}
+	m.count.WithLabelValues(host, req.Method, code).Inc()
+	m.duration.WithLabelValues(host, req.Method, code).Observe(time.Since(trace.start).Seconds())
+	return resp, err
+}
+
+func (t *httpClientTrace) observe(event string, start time.Time) {
+	t.observer.WithLabelValues(t.host, event).Observe(time.Since(start).Seconds())
+}
+
+func (t *httpClientTrace) newClientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.Lock()
+			t.dns = time.Now()
+			t.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.Lock()
+			defer t.Unlock()
+			t.observe("dns", t.dns)
+		},
+		ConnectStart: func(_, addr string) {
+			t.Lock()
+			defer t.Unlock()
+			if t.connects == nil {
+				t.connects = make(map[string]time.Time)
+			}
+			t.connects[addr] = time.Now()
+		},
+		ConnectDone: func(_, addr string, err error) {
+			t.Lock()
+			defer t.Unlock()
+			if start, ok := t.connects[addr]; ok && err == nil {
+				t.observe("connect", start)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.Lock()
+			t.tls = time.Now()
+			t.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			t.Lock()
+			defer t.Unlock()
+			if err == nil {
+				t.observe("tls", t.tls)
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.observe("first_byte", t.start)
+		},
+	}
+}
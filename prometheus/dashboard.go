@@ -0,0 +1,309 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/eudore/eudore"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DashboardConfig 定义生成Grafana dashboard的配置。
+//
+// Namespace和Subsystem需要和Config相同，Namespace默认prometheus，
+// 只使用前缀匹配的http请求和http客户端监控项，避免同名业务监控项生成错误面板。
+type DashboardConfig struct {
+	Title      string `json:"title" alias:"title"`
+	Service    string `json:"service" alias:"service"`
+	Datasource string `json:"datasource" alias:"datasource"`
+	Namespace  string `json:"namespace" alias:"namespace"`
+	Subsystem  string `json:"subsystem" alias:"subsystem"`
+}
+
+// dashboard 定义根据已注册监控项生成dashboard的过程数据。
+type dashboard struct {
+	*DashboardConfig
+	families map[string]*dto.MetricFamily
+	panels   []map[string]interface{}
+	row      []map[string]interface{}
+	y        int
+}
+
+// NewDashboard 函数使用已注册的监控项生成Grafana dashboard json，
+// 包含http请求RED、http客户端、数据库、tracer和运行时面板，只生成存在监控项的面板。
+func NewDashboard(config *DashboardConfig, mfs []*dto.MetricFamily) ([]byte, error) {
+	if config.Title == "" {
+		config.Title = config.Service
+	}
+	if config.Datasource == "" {
+		config.Datasource = "prometheus"
+	}
+	config.Namespace = eudore.GetString(config.Namespace, "prometheus")
+	d := &dashboard{DashboardConfig: config, families: make(map[string]*dto.MetricFamily, len(mfs))}
+	for _, mf := range mfs {
+		d.families[mf.GetName()] = mf
+	}
+	d.addHTTP()
+	d.addHTTPClient()
+	d.addDatabase()
+	d.addTracer()
+	d.addRuntime()
+	d.flush()
+
+	return json.MarshalIndent(map[string]interface{}{
+		"title":         config.Title,
+		"tags":          []string{"endpoint", config.Service},
+		"timezone":      "browser",
+		"schemaVersion": 36,
+		"refresh":       "30s",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"templating": map[string]interface{}{"list": []interface{}{
+			map[string]interface{}{
+				"name":    "datasource",
+				"type":    "datasource",
+				"query":   "prometheus",
+				"current": map[string]string{"text": config.Datasource, "value": config.Datasource},
+			},
+			map[string]interface{}{
+				"name":    "service",
+				"type":    "textbox",
+				"query":   config.Service,
+				"current": map[string]string{"text": config.Service, "value": config.Service},
+			},
+		}},
+		"panels": d.panels,
+	}, "", "\t")
+}
+
+// find 方法返回存在的监控项名称。
+func (d *dashboard) find(name string) string {
+	if _, ok := d.families[name]; ok {
+		return name
+	}
+	return ""
+}
+
+// findEndpoint 方法返回使用Namespace和Subsystem前缀的endpoint监控项名称。
+func (d *dashboard) findEndpoint(name string) string {
+	return d.find(prometheus.BuildFQName(d.Namespace, d.Subsystem, name))
+}
+
+// hasLabel 方法检查监控项是否存在标签。
+func (d *dashboard) hasLabel(name, label string) bool {
+	for _, m := range d.families[name].GetMetric() {
+		for _, pair := range m.Label {
+			if pair.GetName() == label {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selector 方法返回监控项的标签选择器，存在service标签时使用$service过滤。
+func (d *dashboard) selector(name string, matchers ...string) string {
+	if d.hasLabel(name, "service") {
+		matchers = append([]string{`service="$service"`}, matchers...)
+	}
+	return "{" + strings.Join(matchers, ",") + "}"
+}
+
+// groupBy 方法返回监控项存在的第一个分组标签。
+func (d *dashboard) groupBy(name string, labels ...string) string {
+	for _, label := range labels {
+		if d.hasLabel(name, label) {
+			return label
+		}
+	}
+	return ""
+}
+
+func (d *dashboard) rate(name string, by string, matchers ...string) string {
+	return fmt.Sprintf("sum by (%s) (rate(%s%s[$__rate_interval]))", by, name, d.selector(name, matchers...))
+}
+
+func (d *dashboard) quantile(name string, quantile string, by string) string {
+	if d.families[name].GetType() == dto.MetricType_SUMMARY {
+		return fmt.Sprintf("max by (%s) (%s%s)", by, name, d.selector(name, `quantile="`+quantile+`"`))
+	}
+	return fmt.Sprintf("histogram_quantile(%s, sum by (le, %s) (rate(%s_bucket%s[$__rate_interval])))",
+		quantile, by, name, d.selector(name))
+}
+
+func (d *dashboard) legend(by string) string {
+	if by == "" {
+		return "{{__name__}}"
+	}
+	return "{{" + by + "}}"
+}
+
+// addRow 方法添加一行面板，每行最多3个面板。
+func (d *dashboard) addRow(title string) {
+	d.flush()
+	d.panels = append(d.panels, map[string]interface{}{
+		"type":      "row",
+		"title":     title,
+		"collapsed": false,
+		"gridPos":   map[string]int{"h": 1, "w": 24, "x": 0, "y": d.y},
+		"id":        len(d.panels) + 1,
+		"panels":    []interface{}{},
+	})
+	d.y++
+}
+
+func (d *dashboard) addPanel(title, unit string, targets ...string) {
+	if len(d.row) == 3 {
+		d.flush()
+	}
+	list := make([]map[string]string, 0, len(targets)/2)
+	for i := 0; i+1 < len(targets); i += 2 {
+		list = append(list, map[string]string{
+			"expr":         targets[i],
+			"legendFormat": targets[i+1],
+			"refId":        string(rune('A' + i/2)),
+		})
+	}
+	d.row = append(d.row, map[string]interface{}{
+		"type":        "timeseries",
+		"title":       title,
+		"datasource":  map[string]string{"type": "prometheus", "uid": "${datasource}"},
+		"fieldConfig": map[string]interface{}{"defaults": map[string]string{"unit": unit}, "overrides": []interface{}{}},
+		"targets":     list,
+	})
+}
+
+func (d *dashboard) flush() {
+	for i, panel := range d.row {
+		panel["id"] = len(d.panels) + 1
+		panel["gridPos"] = map[string]int{"h": 8, "w": 8, "x": i * 8, "y": d.y}
+		d.panels = append(d.panels, panel)
+	}
+	if len(d.row) > 0 {
+		d.y += 8
+	}
+	d.row = d.row[:0]
+}
+
+func (d *dashboard) addHTTP() {
+	count := d.findEndpoint(PrometheusCountName)
+	if count == "" {
+		return
+	}
+	by := d.groupBy(count, "path", "action", "handler")
+	d.addRow("HTTP")
+	d.addPanel("Requests", "reqps", d.rate(count, by), d.legend(by))
+	if d.hasLabel(count, "code") {
+		d.addPanel("Errors", "percentunit",
+			fmt.Sprintf("%s / %s", d.rate(count, by, `code=~"5.."`), d.rate(count, by)), d.legend(by))
+	}
+	if duration := d.findEndpoint(PrometheusDurationName); duration != "" {
+		d.addPanel("Duration p99", "s", d.quantile(duration, "0.99", by), d.legend(by))
+		d.addPanel("Duration p50", "s", d.quantile(duration, "0.5", by), d.legend(by))
+	}
+	if first := d.findEndpoint(PrometheusFirstByteName); first != "" {
+		d.addPanel("First Byte p99", "s", d.quantile(first, "0.99", by), d.legend(by))
+	}
+	if inflight := d.findEndpoint(PrometheusInflightName); inflight != "" {
+		d.addPanel("In Flight", "short", fmt.Sprintf("sum by (%s) (%s%s)", by, inflight, d.selector(inflight)), d.legend(by))
+	}
+	if canceled := d.findEndpoint(PrometheusCanceledName); canceled != "" {
+		d.addPanel("Canceled", "reqps", d.rate(canceled, "reason"), "{{reason}}")
+	}
+	if slo := d.findEndpoint(PrometheusSLOTotalName); slo != "" {
+		good := d.findEndpoint(PrometheusSLOGoodName)
+		d.addPanel("SLO Error Ratio", "percentunit",
+			fmt.Sprintf("1 - %s / %s", d.rate(good, "slo"), d.rate(slo, "slo")), "{{slo}}")
+	}
+}
+
+func (d *dashboard) addHTTPClient() {
+	count := d.findEndpoint(PrometheusClientCountName)
+	if count == "" {
+		return
+	}
+	d.addRow("HTTP Client")
+	d.addPanel("Requests", "reqps", d.rate(count, "host"), "{{host}}")
+	d.addPanel("Errors", "reqps", d.rate(count, "host", `code=~"5xx|error"`), "{{host}}")
+	if duration := d.findEndpoint(PrometheusClientDurationName); duration != "" {
+		d.addPanel("Duration p99", "s", d.quantile(duration, "0.99", "host"), "{{host}}")
+	}
+	if trace := d.findEndpoint(PrometheusClientTraceName); trace != "" {
+		d.addPanel("Connection p99", "s", d.quantile(trace, "0.99", "event"), "{{event}}")
+	}
+}
+
+func (d *dashboard) addDatabase() {
+	duration := d.find("gorm_query_duration_seconds")
+	open := d.find("go_sql_open_connections")
+	if duration == "" && open == "" {
+		return
+	}
+	d.addRow("Database")
+	if duration != "" {
+		d.addPanel("Queries", "ops", fmt.Sprintf("sum by (operation, table) (rate(%s_count%s[$__rate_interval]))", duration, d.selector(duration)), "{{operation}} {{table}}")
+		d.addPanel("Query p99", "s", d.quantile(duration, "0.99", "operation, table"), "{{operation}} {{table}}")
+	}
+	if errors := d.find("gorm_query_errors_total"); errors != "" {
+		d.addPanel("Query Errors", "ops", d.rate(errors, "operation, table"), "{{operation}} {{table}}")
+	}
+	if open != "" {
+		targets := []string{}
+		for _, name := range []string{"go_sql_open_connections", "go_sql_in_use_connections", "go_sql_idle_connections"} {
+			if name = d.find(name); name != "" {
+				targets = append(targets, fmt.Sprintf("sum by (db_name) (%s%s)", name, d.selector(name)), strings.TrimPrefix(name, "go_sql_")+" {{db_name}}")
+			}
+		}
+		d.addPanel("Connections", "short", targets...)
+	}
+	if wait := d.find("go_sql_wait_duration_seconds_total"); wait != "" {
+		d.addPanel("Connection Wait", "s", d.rate(wait, "db_name"), "{{db_name}}")
+	}
+}
+
+func (d *dashboard) addTracer() {
+	started := d.find("jaeger_tracer_started_spans_total")
+	if started == "" {
+		return
+	}
+	d.addRow("Tracer")
+	d.addPanel("Started Spans", "ops", d.rate(started, "sampled"), "sampled={{sampled}}")
+	if reporter := d.find("jaeger_tracer_reporter_spans_total"); reporter != "" {
+		d.addPanel("Reporter Spans", "ops", d.rate(reporter, "result"), "{{result}}")
+	}
+	if queue := d.find("jaeger_tracer_reporter_queue_length"); queue != "" {
+		d.addPanel("Reporter Queue", "short", fmt.Sprintf("sum(%s%s)", queue, d.selector(queue)), "queue")
+	}
+}
+
+func (d *dashboard) addRuntime() {
+	var panels [][3]string
+	for _, item := range [][3]string{
+		{"go_goroutines", "Goroutines", "short"},
+		{"process_resident_memory_bytes", "Resident Memory", "bytes"},
+		{"go_memstats_heap_alloc_bytes", "Heap Alloc", "bytes"},
+		{"process_cpu_seconds_total", "CPU", "percentunit"},
+		{"go_gc_duration_seconds", "GC Duration", "s"},
+		{"process_open_fds", "Open FDs", "short"},
+	} {
+		if d.find(item[0]) != "" {
+			panels = append(panels, item)
+		}
+	}
+	if len(panels) == 0 {
+		return
+	}
+	d.addRow("Runtime")
+	for _, item := range panels {
+		name := d.find(item[0])
+		expr := fmt.Sprintf("%s%s", name, d.selector(name))
+		switch item[0] {
+		case "process_cpu_seconds_total":
+			expr = fmt.Sprintf("rate(%s[$__rate_interval])", expr)
+		case "go_gc_duration_seconds":
+			expr = fmt.Sprintf("%s%s", name, d.selector(name, `quantile="1"`))
+		}
+		d.addPanel(item[1], item[2], expr, "{{instance}}")
+	}
+}
@@ -0,0 +1,90 @@
+package prometheus
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newTestDashboardFamilies 函数创建生成dashboard使用的监控项，包含同名后缀的业务监控项。
+func newTestDashboardFamilies(t *testing.T) []*dto.MetricFamily {
+	reg := prometheus.NewRegistry()
+	service := prometheus.Labels{"service": "api"}
+	labels := []string{"code", "method", "path"}
+	newCounter := func(name string, labels ...string) *prometheus.CounterVec {
+		vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: name, ConstLabels: service}, labels)
+		reg.MustRegister(vec)
+		return vec
+	}
+	newHistogram := func(name string, labels ...string) *prometheus.HistogramVec {
+		vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: name, ConstLabels: service}, labels)
+		reg.MustRegister(vec)
+		return vec
+	}
+
+	newCounter("app_api_http_requests_total", labels...).WithLabelValues("200", "GET", "/users").Inc()
+	newHistogram("app_api_http_request_duration_seconds", labels...).WithLabelValues("200", "GET", "/users").Observe(0.1)
+	newCounter("app_api_http_client_requests_total", "host", "method", "code").WithLabelValues("db", "GET", "200").Inc()
+	newHistogram("app_api_http_client_request_duration_seconds", "host", "method", "code").WithLabelValues("db", "GET", "200").Observe(0.1)
+	newHistogram("gorm_query_duration_seconds", "operation", "table").WithLabelValues("select", "users").Observe(0.01)
+	// 不是endpoint前缀的监控项不能用于http面板。
+	newCounter("orders_http_requests_total", "status").WithLabelValues("paid").Inc()
+	newCounter("prometheus_http_requests_total", "handler").WithLabelValues("/metrics").Inc()
+	newCounter("orders_http_client_requests_total", "status").WithLabelValues("paid").Inc()
+	reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "go_goroutines", Help: "goroutines"}, func() float64 { return 1 }))
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mfs
+}
+
+func TestDashboard(t *testing.T) {
+	data, err := NewDashboard(&DashboardConfig{
+		Service:   "api",
+		Namespace: "app",
+		Subsystem: "api",
+	}, newTestDashboardFamilies(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, '\n')
+	for _, name := range []string{"orders_http", "prometheus_http"} {
+		if bytes.Contains(data, []byte(name)) {
+			t.Errorf("dashboard use metric %s", name)
+		}
+	}
+
+	golden := "testdata/dashboard.json"
+	if *updateGolden {
+		err = os.WriteFile(golden, data, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, expect) {
+		t.Errorf("dashboard differ from %s:\n%s", golden, data)
+	}
+}
+
+func TestDashboardNamespace(t *testing.T) {
+	// 默认namespace为prometheus。
+	data, err := NewDashboard(&DashboardConfig{Service: "api"}, newTestDashboardFamilies(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(data)
+	if !strings.Contains(body, "prometheus_http_requests_total") || strings.Contains(body, "app_api_http") ||
+		strings.Contains(body, "orders_http") || strings.Contains(body, `"HTTP Client"`) {
+		t.Errorf("dashboard default namespace:\n%s", body)
+	}
+}
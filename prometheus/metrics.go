@@ -0,0 +1,189 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Metrics 定义业务监控项集合，使用名称定义和获取监控项。
+type Metrics struct {
+	sync.RWMutex
+	Registerer  prometheus.Registerer
+	ConstLabels prometheus.Labels
+	metrics     map[string]*Metric
+}
+
+// Metric 定义一个业务监控项。
+type Metric struct {
+	Name      string
+	Type      string
+	Labels    []string
+	counter   *prometheus.CounterVec
+	gauge     *prometheus.GaugeVec
+	histogram *prometheus.HistogramVec
+}
+
+// MetricContext 定义绑定请求context的监控项，记录数据时附加trace exemplar。
+//
+// 未定义的监控项Metric为nil，记录数据时返回错误。
+type MetricContext struct {
+	*Metric
+	Name    string
+	Context context.Context
+}
+
+// NewMetrics 函数创建业务监控项集合，监控项注册到reg并附加service标签。
+func NewMetrics(name string, reg prometheus.Registerer) *Metrics {
+	return &Metrics{
+		Registerer:  reg,
+		ConstLabels: prometheus.Labels{"service": name},
+		metrics:     make(map[string]*Metric),
+	}
+}
+
+// DefineCounter 方法定义counter监控项。
+func (m *Metrics) DefineCounter(name, help string, labels ...string) error {
+	return m.define(&Metric{Name: name, Type: "counter", Labels: labels, counter: prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: name, Help: help, ConstLabels: m.ConstLabels}, labels,
+	)})
+}
+
+// DefineGauge 方法定义gauge监控项。
+func (m *Metrics) DefineGauge(name, help string, labels ...string) error {
+	return m.define(&Metric{Name: name, Type: "gauge", Labels: labels, gauge: prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{Name: name, Help: help, ConstLabels: m.ConstLabels}, labels,
+	)})
+}
+
+// DefineHistogram 方法定义histogram监控项，buckets为空使用默认分桶。
+func (m *Metrics) DefineHistogram(name, help string, buckets []float64, labels ...string) error {
+	return m.define(&Metric{Name: name, Type: "histogram", Labels: labels, histogram: prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Name: name, Help: help, ConstLabels: m.ConstLabels, Buckets: buckets}, labels,
+	)})
+}
+
+func (m *Metrics) define(metric *Metric) error {
+	if !model.IsValidMetricName(model.LabelValue(metric.Name)) {
+		return fmt.Errorf("prometheus metric name '%s' is invalid", metric.Name)
+	}
+	names := make(map[string]bool, len(metric.Labels))
+	for _, label := range metric.Labels {
+		switch {
+		case !model.LabelName(label).IsValid() || strings.HasPrefix(label, "__"):
+			return fmt.Errorf("prometheus metric '%s' label '%s' is invalid", metric.Name, label)
+		case m.ConstLabels[label] != "" || names[label]:
+			return fmt.Errorf("prometheus metric '%s' label '%s' is duplicate", metric.Name, label)
+		}
+		names[label] = true
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.metrics[metric.Name]; ok {
+		return fmt.Errorf("prometheus metric '%s' is already defined", metric.Name)
+	}
+	err := m.Registerer.Register(metric.collector())
+	if err != nil {
+		return err
+	}
+	m.metrics[metric.Name] = metric
+	return nil
+}
+
+// Metric 方法返回绑定context的监控项，Metrics为nil时监控项未定义，记录数据时返回错误。
+func (m *Metrics) Metric(ctx context.Context, name string) MetricContext {
+	if m == nil {
+		return MetricContext{nil, name, ctx}
+	}
+	m.RLock()
+	defer m.RUnlock()
+	return MetricContext{m.metrics[name], name, ctx}
+}
+
+func (metric *Metric) collector() prometheus.Collector {
+	switch metric.Type {
+	case "counter":
+		return metric.counter
+	case "gauge":
+		return metric.gauge
+	default:
+		return metric.histogram
+	}
+}
+
+// Inc 方法counter或gauge加1。
+func (m MetricContext) Inc(labels ...string) error {
+	return m.Add(1, labels...)
+}
+
+// Add 方法counter或gauge增加值，counter增加负数返回错误。
+func (m MetricContext) Add(val float64, labels ...string) error {
+	if m.Metric == nil {
+		return fmt.Errorf("prometheus metric '%s' is undefined", m.Name)
+	}
+	switch m.Type {
+	case "counter":
+		if val < 0 {
+			return fmt.Errorf("prometheus counter '%s' cannot decrease: %g", m.Name, val)
+		}
+		counter, err := m.counter.GetMetricWithLabelValues(labels...)
+		if err != nil {
+			return err
+		}
+		if exemplar := newExemplar(m.Context); exemplar != nil {
+			counter.(prometheus.ExemplarAdder).AddWithExemplar(val, exemplar)
+		} else {
+			counter.Add(val)
+		}
+	case "gauge":
+		gauge, err := m.gauge.GetMetricWithLabelValues(labels...)
+		if err != nil {
+			return err
+		}
+		gauge.Add(val)
+	default:
+		return fmt.Errorf("prometheus metric '%s' type %s not support add", m.Name, m.Type)
+	}
+	return nil
+}
+
+// Set 方法设置gauge的值。
+func (m MetricContext) Set(val float64, labels ...string) error {
+	if m.Metric == nil {
+		return fmt.Errorf("prometheus metric '%s' is undefined", m.Name)
+	}
+	if m.Type != "gauge" {
+		return fmt.Errorf("prometheus metric '%s' type %s not support set", m.Name, m.Type)
+	}
+	gauge, err := m.gauge.GetMetricWithLabelValues(labels...)
+	if err != nil {
+		return err
+	}
+	gauge.Set(val)
+	return nil
+}
+
+// Observe 方法histogram记录值。
+func (m MetricContext) Observe(val float64, labels ...string) error {
+	if m.Metric == nil {
+		return fmt.Errorf("prometheus metric '%s' is undefined", m.Name)
+	}
+	if m.Type != "histogram" {
+		return fmt.Errorf("prometheus metric '%s' type %s not support observe", m.Name, m.Type)
+	}
+	observer, err := m.histogram.GetMetricWithLabelValues(labels...)
+	if err != nil {
+		return err
+	}
+	if exemplar := newExemplar(m.Context); exemplar != nil {
+		observer.(prometheus.ExemplarObserver).ObserveWithExemplar(val, exemplar)
+	} else {
+		observer.Observe(val)
+	}
+	return nil
+}
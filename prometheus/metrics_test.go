@@ -0,0 +1,139 @@
+package prometheus
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/eudore/endpoint/tracer"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMetricsDefine(t *testing.T) {
+	metrics := NewMetrics("test", prometheus.NewRegistry())
+	for _, expect := range []struct {
+		err    string
+		define func() error
+	}{
+		{"", func() error { return metrics.DefineCounter("orders_total", "orders", "status") }},
+		{"", func() error { return metrics.DefineGauge("orders_pending", "pending") }},
+		{"", func() error { return metrics.DefineHistogram("orders_amount", "amount", []float64{1, 10}, "status") }},
+		{"name 'orders-total' is invalid", func() error { return metrics.DefineCounter("orders-total", "orders") }},
+		{"label 'order-id' is invalid", func() error { return metrics.DefineCounter("orders_id", "orders", "order-id") }},
+		{"label '__name' is invalid", func() error { return metrics.DefineCounter("orders_name", "orders", "__name") }},
+		{"label 'status' is duplicate", func() error { return metrics.DefineCounter("orders_dup", "orders", "status", "status") }},
+		{"label 'service' is duplicate", func() error { return metrics.DefineGauge("orders_service", "orders", "service") }},
+		{"'orders_total' is already defined", func() error { return metrics.DefineGauge("orders_total", "orders") }},
+	} {
+		err := expect.define()
+		if (expect.err == "" && err != nil) || (expect.err != "" && (err == nil || !strings.Contains(err.Error(), expect.err))) {
+			t.Errorf("metrics define error %v, want %q", err, expect.err)
+		}
+	}
+
+	// 监控项已经注册到registry时返回注册错误。
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "orders_total", Help: "orders"}))
+	err := NewMetrics("test", reg).DefineGauge("orders_total", "orders")
+	if err == nil {
+		t.Error("metrics define registered collector not error")
+	}
+}
+
+func TestMetricsRecord(t *testing.T) {
+	metrics := NewMetrics("test", prometheus.NewRegistry())
+	metrics.DefineCounter("orders_total", "orders", "status")
+	metrics.DefineGauge("orders_pending", "pending")
+	metrics.DefineHistogram("orders_amount", "amount", []float64{1, 10})
+	ctx := context.Background()
+
+	for _, expect := range []struct {
+		err    string
+		record func() error
+	}{
+		{"", func() error { return metrics.Metric(ctx, "orders_total").Inc("paid") }},
+		{"", func() error { return metrics.Metric(ctx, "orders_total").Add(2, "paid") }},
+		{"cannot decrease", func() error { return metrics.Metric(ctx, "orders_total").Add(-1, "paid") }},
+		{"inconsistent label cardinality", func() error { return metrics.Metric(ctx, "orders_total").Inc() }},
+		{"type counter not support set", func() error { return metrics.Metric(ctx, "orders_total").Set(1, "paid") }},
+		{"type counter not support observe", func() error { return metrics.Metric(ctx, "orders_total").Observe(1, "paid") }},
+		{"", func() error { return metrics.Metric(ctx, "orders_pending").Set(5) }},
+		{"", func() error { return metrics.Metric(ctx, "orders_pending").Add(-2) }},
+		{"type gauge not support observe", func() error { return metrics.Metric(ctx, "orders_pending").Observe(1) }},
+		{"", func() error { return metrics.Metric(ctx, "orders_amount").Observe(3) }},
+		{"type histogram not support add", func() error { return metrics.Metric(ctx, "orders_amount").Inc() }},
+		{"type histogram not support set", func() error { return metrics.Metric(ctx, "orders_amount").Set(1) }},
+		{"'orders_none' is undefined", func() error { return metrics.Metric(ctx, "orders_none").Inc() }},
+		{"'orders_none' is undefined", func() error { return metrics.Metric(ctx, "orders_none").Set(1) }},
+		{"'orders_none' is undefined", func() error { return metrics.Metric(ctx, "orders_none").Observe(1) }},
+		// prometheus没有解析时Metrics为nil。
+		{"'orders_total' is undefined", func() error { return (*Metrics)(nil).Metric(ctx, "orders_total").Inc("paid") }},
+	} {
+		err := expect.record()
+		if (expect.err == "" && err != nil) || (expect.err != "" && (err == nil || !strings.Contains(err.Error(), expect.err))) {
+			t.Errorf("metrics record error %v, want %q", err, expect.err)
+		}
+	}
+
+	counter, _ := metrics.metrics["orders_total"].counter.GetMetricWithLabelValues("paid")
+	if val := testutil.ToFloat64(counter); val != 3 {
+		t.Errorf("metrics counter value %v", val)
+	}
+	if val := testutil.ToFloat64(metrics.metrics["orders_pending"].gauge); val != 3 {
+		t.Errorf("metrics gauge value %v", val)
+	}
+}
+
+func TestMetricsExemplar(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics := NewMetrics("test", reg)
+	metrics.DefineCounter("orders_total", "orders")
+	metrics.DefineHistogram("orders_amount", "amount", []float64{1, 10})
+
+	span := tracer.NewMockTracer().StartSpan("order")
+	ctx := opentracing.ContextWithSpan(context.Background(), span)
+	ctx = context.WithValue(ctx, tracer.ContextItemBaggageFields, map[string]string{"tenant": "t1", "invalid-key": "v"})
+	metrics.Metric(ctx, "orders_total").Inc()
+	metrics.Metric(ctx, "orders_amount").Observe(3)
+	traceID := tracer.GetTraceID(ctx)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exemplars := make(map[string]*dto.Exemplar)
+	for _, mf := range mfs {
+		m := mf.GetMetric()[0]
+		switch mf.GetName() {
+		case "orders_total":
+			exemplars[mf.GetName()] = m.GetCounter().GetExemplar()
+		case "orders_amount":
+			exemplars[mf.GetName()] = m.GetHistogram().GetBucket()[1].GetExemplar()
+		}
+	}
+	for name, exemplar := range exemplars {
+		labels := make(map[string]string)
+		for _, label := range exemplar.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		if len(labels) != 2 || labels[PrometheusExemplarTraceID] != traceID || labels["tenant"] != "t1" {
+			t.Errorf("metrics %s exemplar %v", name, labels)
+		}
+	}
+	if len(exemplars) != 2 {
+		t.Errorf("metrics exemplars %d", len(exemplars))
+	}
+
+	// 没有采样的请求不附加exemplar。
+	reg = prometheus.NewRegistry()
+	metrics = NewMetrics("test", reg)
+	metrics.DefineCounter("orders_total", "orders")
+	metrics.Metric(context.Background(), "orders_total").Inc()
+	mfs, _ = reg.Gather()
+	if mfs[0].GetMetric()[0].GetCounter().GetExemplar() != nil {
+		t.Error("metrics exemplar without trace")
+	}
+}
@@ -1,75 +1,440 @@
 package prometheus
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/eudore/endpoint/tracer"
 	"github.com/eudore/eudore"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
 )
 
 var (
 	// PrometheusInflightName 定义当前请求的监控项名称
-	PrometheusInflightName = "prometheus_http_requests_in_flight"
+	PrometheusInflightName = "http_requests_in_flight"
 	// PrometheusInflightHelp 定义当前请求的监控项名称
 	PrometheusInflightHelp = "Current number of scrapes being served."
 	// PrometheusCountName 定义总请求的监控项名称
-	PrometheusCountName = "prometheus_http_requests_total"
+	PrometheusCountName = "http_requests_total"
 	// PrometheusCountHelp 定义总请求的监控项名称
 	PrometheusCountHelp = "Total number of scrapes by HTTP status code."
 	// PrometheusDurationName 定义响应状态码的监控项名称
-	PrometheusDurationName = "prometheus_http_request_duration_seconds"
+	PrometheusDurationName = "http_request_duration_seconds"
 	// PrometheusDurationHelp 定义响应状态码的监控项名称
 	PrometheusDurationHelp = "Histogram of latencies for HTTP requests."
 	// PrometheusResponseSizeName 定义响应body大小的监控项名称
-	PrometheusResponseSizeName = "prometheus_http_response_size_bytes"
+	PrometheusResponseSizeName = "http_response_size_bytes"
 	// PrometheusResponseSizeHelp 定义响应body大小的监控项名称
 	PrometheusResponseSizeHelp = "Histogram of response size for HTTP requests."
+	// PrometheusRequestSizeName 定义请求body大小的监控项名称
+	PrometheusRequestSizeName = "http_request_size_bytes"
+	// PrometheusRequestSizeHelp 定义请求body大小的监控项名称
+	PrometheusRequestSizeHelp = "Histogram of request body size for HTTP requests."
+	// PrometheusFirstByteName 定义响应首字节耗时的监控项名称
+	PrometheusFirstByteName = "http_request_first_byte_seconds"
+	// PrometheusFirstByteHelp 定义响应首字节耗时的监控项名称
+	PrometheusFirstByteHelp = "Histogram of latencies to the first response byte for HTTP requests."
+	// PrometheusStageName 定义请求处理函数独占耗时的监控项名称
+	PrometheusStageName = "http_request_stage_duration_seconds"
+	// PrometheusStageHelp 定义请求处理函数独占耗时的监控项名称
+	PrometheusStageHelp = "Histogram of exclusive latencies for each HTTP handler stage."
+	// PrometheusCanceledName 定义客户端取消请求的监控项名称
+	PrometheusCanceledName = "http_requests_canceled_total"
+	// PrometheusCanceledHelp 定义客户端取消请求的监控项名称
+	PrometheusCanceledHelp = "Total number of HTTP requests whose context was canceled or exceeded deadline."
+	// PrometheusDroppedName 定义超过标签组合上限的请求数量的监控项名称
+	PrometheusDroppedName = "http_series_dropped_total"
+	// PrometheusDroppedHelp 定义超过标签组合上限的请求数量的监控项名称
+	PrometheusDroppedHelp = "Total number of requests recorded to the overflow series after reaching max series."
+	// PrometheusUnmatchedPath 定义未匹配路由的path标签值
+	PrometheusUnmatchedPath = "unmatched"
+	// PrometheusOverflowValue 定义超过标签组合上限后使用的标签值
+	PrometheusOverflowValue = "other"
+	// PrometheusExemplarTraceID 定义exemplar中trace id的标签名称
+	PrometheusExemplarTraceID = "trace_id"
 )
 
+// Config 定义prometheus配置。
+//
+// Labels定义http请求监控项的标签，可选code、method、path(路由模板)、handler、action、policy，
+// 默认code、method、path、handler；MaxSeries定义除code和method外的最大标签组合数量，默认1000。
+//
+// Namespace和Subsystem定义http请求监控项名称前缀，Namespace默认prometheus；
+// DurationBuckets和SizeBuckets定义histogram分桶，SizeBuckets默认100B到1GB，
+// NativeHistogramFactor大于1时同时启用native histogram；
+// Objectives不为空时请求耗时使用summary记录，key为分位数。
+//
+// SLOs定义按照action参数记录的slo事件，NewSLORules生成对应的Prometheus规则。
+//
+// Push定义推送监控数据到Pushgateway，用于无法被采集的短时任务；
+// RemoteWrite定义使用remote write协议发送监控数据，用于Prometheus无法访问的部署。
+//
+// Stages为true时记录每个处理函数(中间件)的独占耗时，处理函数嵌套调用的耗时从上级扣除。
+//
+// ConstLabels定义全部监控项附加的标签(例如pod、region，go采集器的go_info已经使用version标签)，
+// Collectors定义启用的采集器，可选process、go、build，默认process、go。
+type Config struct {
+	Namespace             string             `json:"namespace" alias:"namespace"`
+	Subsystem             string             `json:"subsystem" alias:"subsystem"`
+	Labels                []string           `json:"labels" alias:"labels"`
+	MaxSeries             int                `json:"maxseries" alias:"maxseries"`
+	DurationBuckets       []float64          `json:"durationbuckets" alias:"durationbuckets"`
+	SizeBuckets           []float64          `json:"sizebuckets" alias:"sizebuckets"`
+	NativeHistogramFactor float64            `json:"nativehistogramfactor" alias:"nativehistogramfactor"`
+	Objectives            map[string]float64 `json:"objectives" alias:"objectives"`
+	ConstLabels           map[string]string  `json:"constlabels" alias:"constlabels"`
+	Collectors            []string           `json:"collectors" alias:"collectors"`
+	Stages                bool               `json:"stages" alias:"stages"`
+	Push                  PushConfig         `json:"push" alias:"push"`
+	RemoteWrite           RemoteWriteConfig  `json:"remotewrite" alias:"remotewrite"`
+	SLOs                  []SLOConfig        `json:"slos" alias:"slos"`
+}
+
 // Prometheus 定义prometheus使用的对象。
 type Prometheus interface {
 	prometheus.Registerer
 	prometheus.Gatherer
 }
 
-// NewPrometheus 函数初始化prometheus。
+type registry struct {
+	prometheus.Registerer
+	prometheus.Gatherer
+}
+
+// NewPrometheus 函数使用默认配置初始化prometheus，注册process和go采集器。
 func NewPrometheus() Prometheus {
-	prom := prometheus.NewRegistry()
-	prom.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}), prometheus.NewGoCollector())
+	prom, err := NewPrometheusConfig(&Config{})
+	if err != nil {
+		panic(err)
+	}
 	return prom
 }
 
-// NewPrometheusHandler 函数创建一个prometheus http请求记录函数。
+// NewPrometheusConfig 函数使用配置初始化prometheus，注册的监控项附加ConstLabels标签。
+//
+// 创建时检查Labels、分桶、native histogram和Objectives配置，
+// 避免NewPrometheusHandlerConfig使用相同配置时才返回错误。
+func NewPrometheusConfig(config *Config) (Prometheus, error) {
+	err := checkConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.Collectors == nil {
+		config.Collectors = []string{"process", "go"}
+	}
+	prom := prometheus.NewRegistry()
+	reg := prometheus.WrapRegistererWith(config.ConstLabels, prom)
+	for _, name := range config.Collectors {
+		var collector prometheus.Collector
+		switch name {
+		case "process":
+			collector = prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{})
+		case "go":
+			collector = prometheus.NewGoCollector()
+		case "build":
+			collector = prometheus.NewBuildInfoCollector()
+		default:
+			return nil, fmt.Errorf("未定义prometheus采集器：'%s'", name)
+		}
+		err := reg.Register(collector)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return registry{reg, prom}, nil
+}
+
+// NewPrometheusHandler 函数使用默认配置创建一个prometheus http请求记录函数，注册监控项失败时panic。
 func NewPrometheusHandler(name string, reg prometheus.Registerer) eudore.HandlerFunc {
+	handler, err := NewPrometheusHandlerConfig(name, reg, &Config{})
+	if err != nil {
+		panic(err)
+	}
+	return handler
+}
+
+// NewPrometheusHandlerConfig 函数使用配置创建一个prometheus http请求记录函数。
+//
+// path标签使用路由模板，未匹配路由的请求使用PrometheusUnmatchedPath，
+// 默认标签为code、method、path、handler，可以配置Labels删除handler等标签；
+// method标签只记录标准http方法，其他方法使用PrometheusOverflowValue；
+// 除code和method外的标签组合超过MaxSeries后，记录到PrometheusOverflowValue标签并增加丢弃计数。
+func NewPrometheusHandlerConfig(name string, reg prometheus.Registerer, config *Config) (eudore.HandlerFunc, error) {
+	if len(config.Labels) == 0 {
+		config.Labels = []string{"code", "method", "path", "handler"}
+	}
+	if config.MaxSeries == 0 {
+		config.MaxSeries = 1000
+	}
+	if len(config.SizeBuckets) == 0 {
+		config.SizeBuckets = prometheus.ExponentialBuckets(100, 10, 8)
+	}
+	err := checkConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	getters := make([]func(eudore.Context) string, 0, len(config.Labels))
+	inflightLabels := make([]string, 0, len(config.Labels))
+	for _, label := range config.Labels {
+		if label != "code" {
+			getters = append(getters, labelGetters[label])
+			inflightLabels = append(inflightLabels, label)
+		}
+	}
+
+	config.Namespace = eudore.GetString(config.Namespace, "prometheus")
 	service := prometheus.Labels{"service": name}
-	labels := []string{"code", "method", "path", "handler"}
-	httpInflight := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{Name: PrometheusInflightName, Help: PrometheusInflightHelp, ConstLabels: service},
-		[]string{"method", "path", "handler"},
-	)
-	httpCount := prometheus.NewCounterVec(prometheus.CounterOpts{Name: PrometheusCountName, Help: PrometheusCountHelp, ConstLabels: service}, labels)
-	httpDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: PrometheusDurationName, Help: PrometheusDurationHelp, ConstLabels: service}, labels)
-	httpResponseSize := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: PrometheusResponseSizeName, Help: PrometheusResponseSizeHelp, ConstLabels: service}, labels)
-	reg.MustRegister(httpCount, httpInflight, httpDuration, httpResponseSize)
+	httpInflight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: config.Namespace, Subsystem: config.Subsystem,
+		Name: PrometheusInflightName, Help: PrometheusInflightHelp, ConstLabels: service,
+	}, inflightLabels)
+	httpCount := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: config.Namespace, Subsystem: config.Subsystem,
+		Name: PrometheusCountName, Help: PrometheusCountHelp, ConstLabels: service,
+	}, config.Labels)
+	httpDuration, err := newDurationVec(config, service)
+	if err != nil {
+		return nil, err
+	}
+	httpResponseSize := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: config.Namespace, Subsystem: config.Subsystem,
+		Name: PrometheusResponseSizeName, Help: PrometheusResponseSizeHelp, ConstLabels: service,
+		Buckets: config.SizeBuckets, NativeHistogramBucketFactor: config.NativeHistogramFactor,
+	}, config.Labels)
+	httpDropped := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: config.Namespace, Subsystem: config.Subsystem,
+		Name: PrometheusDroppedName, Help: PrometheusDroppedHelp, ConstLabels: service,
+	})
+	httpRequestSize := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: config.Namespace, Subsystem: config.Subsystem,
+		Name: PrometheusRequestSizeName, Help: PrometheusRequestSizeHelp, ConstLabels: service,
+		Buckets: config.SizeBuckets, NativeHistogramBucketFactor: config.NativeHistogramFactor,
+	}, config.Labels)
+	httpFirstByte := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: config.Namespace, Subsystem: config.Subsystem,
+		Name: PrometheusFirstByteName, Help: PrometheusFirstByteHelp, ConstLabels: service,
+		Buckets: config.DurationBuckets, NativeHistogramBucketFactor: config.NativeHistogramFactor,
+	}, config.Labels)
+	httpStage := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: config.Namespace, Subsystem: config.Subsystem,
+		Name: PrometheusStageName, Help: PrometheusStageHelp, ConstLabels: service,
+		Buckets: config.DurationBuckets, NativeHistogramBucketFactor: config.NativeHistogramFactor,
+	}, []string{"stage"})
+	httpCanceled := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: config.Namespace, Subsystem: config.Subsystem,
+		Name: PrometheusCanceledName, Help: PrometheusCanceledHelp, ConstLabels: service,
+	}, []string{"reason"})
+	collectors := []prometheus.Collector{httpCount, httpInflight, httpDuration, httpResponseSize, httpDropped,
+		httpRequestSize, httpFirstByte, httpCanceled}
+	if config.Stages {
+		collectors = append(collectors, httpStage)
+	}
+	slos, err := newSLORecorder(config, service)
+	if err != nil {
+		return nil, err
+	}
+	if slos != nil {
+		collectors = append(collectors, slos.total, slos.good)
+	}
+	for _, collector := range collectors {
+		err = reg.Register(collector)
+		if err != nil {
+			return nil, err
+		}
+	}
+	series := newSeriesLimiter(config.MaxSeries)
 
 	return func(ctx eudore.Context) {
-		labels := prometheus.Labels{
-			"method":  ctx.Method(),
-			"path":    ctx.Path(),
-			"handler": ctx.GetParam(eudore.ParamRoute),
+		vals := make([]string, len(getters), len(getters)+1)
+		for i := range getters {
+			vals[i] = getters[i](ctx)
 		}
-		inflight := httpInflight.With(labels)
+		if !series.Allow(vals) {
+			httpDropped.Inc()
+			for i, label := range inflightLabels {
+				if label != "method" {
+					vals[i] = PrometheusOverflowValue
+				}
+			}
+		}
+
+		inflight := httpInflight.WithLabelValues(vals...)
 		inflight.Inc()
 		defer inflight.Dec()
+		body := &requestBody{ReadCloser: ctx.Request().Body}
+		if body.ReadCloser != nil {
+			ctx.Request().Body = body
+		}
+		w := &responseWriter{ResponseWriter: ctx.Response()}
+		ctx.SetResponse(w)
+		if config.Stages {
+			(&stageTimer{observer: httpStage}).wrapHandlers(ctx)
+		}
 		now := time.Now()
 		ctx.Next()
-		labels["code"] = strconv.Itoa(ctx.Response().Status())
+		elapsed := time.Since(now)
+		ctx.SetResponse(w.ResponseWriter)
+		if w.first.IsZero() {
+			w.first = time.Now()
+		}
+		labels := make(prometheus.Labels, len(config.Labels))
+		for i, label := range inflightLabels {
+			labels[label] = vals[i]
+		}
+		if len(inflightLabels) != len(config.Labels) {
+			labels["code"] = strconv.Itoa(ctx.Response().Status())
+		}
 		httpCount.With(labels).Inc()
-		httpDuration.With(labels).Observe(time.Since(now).Seconds())
+		observeWithExemplar(ctx, httpDuration.With(labels), elapsed.Seconds())
+		httpFirstByte.With(labels).Observe(w.first.Sub(now).Seconds())
+		httpRequestSize.With(labels).Observe(float64(maxInt64(body.size, ctx.Request().ContentLength)))
 		httpResponseSize.With(labels).Observe(float64(ctx.Response().Size()))
+		slos.Record(ctx.GetParam(eudore.ParamAction), ctx.Response().Status(), elapsed)
+		switch ctx.GetContext().Err() {
+		case context.Canceled:
+			httpCanceled.With(prometheus.Labels{"reason": "canceled"}).Inc()
+		case context.DeadlineExceeded:
+			httpCanceled.With(prometheus.Labels{"reason": "deadline"}).Inc()
+		}
+	}, nil
+}
+
+// checkConfig 函数检查配置中会导致创建监控项失败或panic的值。
+func checkConfig(config *Config) error {
+	for _, label := range config.Labels {
+		if _, ok := labelGetters[label]; !ok {
+			return fmt.Errorf("未定义prometheus标签：'%s'", label)
+		}
+	}
+	for name, buckets := range map[string][]float64{
+		"durationbuckets": config.DurationBuckets,
+		"sizebuckets":     config.SizeBuckets,
+	} {
+		for i := 1; i < len(buckets); i++ {
+			if buckets[i] <= buckets[i-1] {
+				return fmt.Errorf("prometheus %s must be in strictly increasing order: %v", name, buckets)
+			}
+		}
+	}
+	if config.NativeHistogramFactor != 0 && config.NativeHistogramFactor <= 1 {
+		return fmt.Errorf("prometheus nativehistogramfactor %v must be greater than 1", config.NativeHistogramFactor)
+	}
+	_, err := parseObjectives(config.Objectives)
+	if err != nil {
+		return err
+	}
+	return checkSLOs(config.SLOs)
+}
+
+// parseObjectives 函数解析summary分位数，分位数范围(0,1)，误差范围[0,1)。
+func parseObjectives(data map[string]float64) (map[float64]float64, error) {
+	objectives := make(map[float64]float64, len(data))
+	for key, val := range data {
+		quantile, err := strconv.ParseFloat(key, 64)
+		if err != nil {
+			return nil, fmt.Errorf("prometheus objectives quantile '%s' is invalid: %v", key, err)
+		}
+		if quantile <= 0 || quantile >= 1 || val < 0 || val >= 1 {
+			return nil, fmt.Errorf("prometheus objectives quantile '%s' error %v is out of range", key, val)
+		}
+		objectives[quantile] = val
+	}
+	return objectives, nil
+}
+
+// newDurationVec 函数创建请求耗时监控项，配置Objectives时使用summary，否则使用histogram。
+func newDurationVec(config *Config, service prometheus.Labels) (prometheus.ObserverVec, error) {
+	if len(config.Objectives) == 0 {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: PrometheusDurationName, Help: PrometheusDurationHelp, ConstLabels: service,
+			Buckets: config.DurationBuckets, NativeHistogramBucketFactor: config.NativeHistogramFactor,
+		}, config.Labels), nil
+	}
+
+	objectives, err := parseObjectives(config.Objectives)
+	if err != nil {
+		return nil, err
+	}
+	return prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: config.Namespace, Subsystem: config.Subsystem,
+		Name: PrometheusDurationName, Help: PrometheusDurationHelp, ConstLabels: service,
+		Objectives: objectives,
+	}, config.Labels), nil
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// labelGetters 定义http请求可用的标签，code在请求处理完成后读取。
+var labelGetters = map[string]func(eudore.Context) string{
+	"code": nil,
+	"method": func(ctx eudore.Context) string {
+		switch method := ctx.Method(); method {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+			http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+			return method
+		default:
+			// method来自客户端，限制取值避免无限增加series。
+			return PrometheusOverflowValue
+		}
+	},
+	"path": func(ctx eudore.Context) string {
+		return eudore.GetString(ctx.GetParam(eudore.ParamRoute), PrometheusUnmatchedPath)
+	},
+	"handler": func(ctx eudore.Context) string {
+		return ctx.GetParam(eudore.ParamRoute)
+	},
+	"action": func(ctx eudore.Context) string {
+		return ctx.GetParam(eudore.ParamAction)
+	},
+	"policy": func(ctx eudore.Context) string {
+		return ctx.GetParam("Policy")
+	},
+}
+
+// observeWithExemplar 函数记录数据，请求存在采样的span时附加exemplar。
+func observeWithExemplar(ctx eudore.Context, observer prometheus.Observer, val float64) {
+	exemplarObserver, ok := observer.(prometheus.ExemplarObserver)
+	exemplar := newExemplar(ctx.GetContext())
+	if !ok || exemplar == nil {
+		observer.Observe(val)
+		return
+	}
+	exemplarObserver.ObserveWithExemplar(val, exemplar)
+}
+
+// newExemplar 函数使用trace id和baggage创建exemplar，span未采样时返回nil。
+//
+// exemplar标签总长度不能超过prometheus.ExemplarMaxRunes，超过长度的baggage标签忽略；
+// 非utf8值和__前缀的保留标签会导致prometheus panic，同样忽略。
+func newExemplar(ctx context.Context) prometheus.Labels {
+	if !tracer.IsSampled(ctx) {
+		return nil
+	}
+	traceID := tracer.GetTraceID(ctx)
+	exemplar := prometheus.Labels{PrometheusExemplarTraceID: traceID}
+	runes := utf8.RuneCountInString(PrometheusExemplarTraceID) + utf8.RuneCountInString(traceID)
+	for k, v := range tracer.GetBaggageFields(ctx) {
+		size := utf8.RuneCountInString(k) + utf8.RuneCountInString(v)
+		if model.LabelName(k).IsValid() && !strings.HasPrefix(k, model.ReservedLabelPrefix) &&
+			utf8.ValidString(v) && runes+size <= prometheus.ExemplarMaxRunes {
+			exemplar[k] = v
+			runes += size
+		}
 	}
+	return exemplar
 }
 
 // NewPrometheusMetrics 函数创建一个prometheus metrics响应处理函数。
@@ -81,7 +446,7 @@ func NewPrometheusMetrics(gatherer prometheus.Gatherer) eudore.HandlerFunc {
 			return
 		}
 
-		contentType := expfmt.Negotiate(ctx.Request().Header)
+		contentType := expfmt.NegotiateIncludingOpenMetrics(ctx.Request().Header)
 		ctx.SetHeader(eudore.HeaderContentType, string(contentType))
 		enc := expfmt.NewEncoder(ctx, contentType)
 
@@ -0,0 +1,46 @@
+package prometheus
+
+import (
+	"testing"
+)
+
+func TestNewPrometheusConfig(t *testing.T) {
+	for name, config := range map[string]*Config{
+		"label":      {Labels: []string{"code", "host"}},
+		"buckets":    {DurationBuckets: []float64{0.1, 0.1, 1}},
+		"size":       {SizeBuckets: []float64{1000, 100}},
+		"native":     {NativeHistogramFactor: 0.5},
+		"quantile":   {Objectives: map[string]float64{"p99": 0.001}},
+		"range":      {Objectives: map[string]float64{"1.5": 0.001}},
+		"error":      {Objectives: map[string]float64{"0.99": 1}},
+		"collectors": {Collectors: []string{"jvm"}},
+	} {
+		_, err := NewPrometheusConfig(config)
+		if err == nil {
+			t.Errorf("%s config not rejected", name)
+		}
+	}
+
+	prom, err := NewPrometheusConfig(&Config{
+		Objectives:  map[string]float64{"0.5": 0.05, "0.99": 0.001},
+		ConstLabels: map[string]string{"pod": "endpoint-0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewPrometheusHandlerConfig("endpoint", prom, &Config{Labels: []string{"code", "host"}})
+	if err == nil {
+		t.Error("handler unknown label not rejected")
+	}
+	_, err = NewPrometheusHandlerConfig("endpoint", prom, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewPrometheusHandlerConfig("endpoint", prom, &Config{})
+	if err == nil {
+		t.Error("handler duplicate register not rejected")
+	}
+	if NewPrometheus() == nil {
+		t.Error("default prometheus is nil")
+	}
+}
@@ -0,0 +1,68 @@
+package prometheus
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/eudore/eudore"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// PushConfig 定义推送监控数据到Pushgateway的配置。
+//
+// URL为空时不推送；Interval定义周期推送间隔，默认15s；
+// Instance定义instance分组标签，默认使用主机名；
+// 正常退出时删除分组，避免Pushgateway一直保留已经退出实例的数据；
+// KeepGroup为true时保留分组，退出时推送最后一次数据，用于需要保留结果的短时任务。
+type PushConfig struct {
+	URL       string        `json:"url" alias:"url"`
+	Interval  time.Duration `json:"interval" alias:"interval"`
+	Instance  string        `json:"instance" alias:"instance"`
+	KeepGroup bool          `json:"keepgroup" alias:"keepgroup"`
+	Username  string        `json:"username" alias:"username"`
+	Password  string        `json:"password" alias:"password"`
+}
+
+// Pusher 定义周期推送监控数据的对象。
+type Pusher struct {
+	*push.Pusher
+	*PushConfig
+	Logger eudore.Logger
+}
+
+// NewPusher 函数创建Pusher，使用job和instance作为分组标签。
+func NewPusher(job string, gatherer prometheus.Gatherer, config *PushConfig) *Pusher {
+	if config.Interval == 0 {
+		config.Interval = 15 * time.Second
+	}
+	if config.Instance == "" {
+		config.Instance, _ = os.Hostname()
+	}
+	pusher := push.New(config.URL, job).Gatherer(gatherer).Grouping("instance", config.Instance)
+	if config.Username != "" {
+		pusher.BasicAuth(config.Username, config.Password)
+	}
+	return &Pusher{Pusher: pusher, PushConfig: config}
+}
+
+// Run 方法周期推送监控数据，ctx结束时删除分组或者推送最后一次数据后返回。
+func (p *Pusher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := p.PushContext(ctx)
+			if err != nil && p.Logger != nil {
+				p.Logger.Warningf("prometheus push to %s error: %v", p.URL, err)
+			}
+		case <-ctx.Done():
+			if p.KeepGroup {
+				return p.Push()
+			}
+			return p.Pusher.Delete()
+		}
+	}
+}
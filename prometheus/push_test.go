@@ -0,0 +1,104 @@
+package prometheus
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pushgateway 定义Pushgateway测试桩，记录请求方法、路径和body。
+type pushgateway struct {
+	sync.Mutex
+	requests []string
+	bodys    []string
+}
+
+func (p *pushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	p.Lock()
+	p.requests = append(p.requests, r.Method+" "+r.URL.Path)
+	p.bodys = append(p.bodys, string(body))
+	p.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (p *pushgateway) Requests() []string {
+	p.Lock()
+	defer p.Unlock()
+	return append([]string{}, p.requests...)
+}
+
+func newTestPusher(t *testing.T, config *PushConfig) (*Pusher, *pushgateway, func()) {
+	gateway := &pushgateway{}
+	srv := httptest.NewServer(gateway)
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_jobs_total", Help: "test"})
+	counter.Inc()
+	reg.MustRegister(counter)
+	config.URL = srv.URL
+	config.Instance = "host1"
+	return NewPusher("job1", reg, config), gateway, srv.Close
+}
+
+func TestPusherPushAndDelete(t *testing.T) {
+	pusher, gateway, closer := newTestPusher(t, &PushConfig{Interval: 10 * time.Millisecond})
+	defer closer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- pusher.Run(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	requests := gateway.Requests()
+	path := "/metrics/job/job1/instance/host1"
+	if len(requests) < 2 || requests[0] != "PUT "+path || requests[len(requests)-1] != "DELETE "+path {
+		t.Fatalf("pushgateway requests %v", requests)
+	}
+	if !strings.Contains(gateway.bodys[0], "test_jobs_total") {
+		t.Errorf("pushgateway body not contain metric: %q", gateway.bodys[0])
+	}
+}
+
+func TestPusherDeleteGroup(t *testing.T) {
+	pusher, gateway, closer := newTestPusher(t, &PushConfig{Interval: time.Hour})
+	defer closer()
+
+	// 默认正常退出删除分组。
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := pusher.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	requests := gateway.Requests()
+	if len(requests) != 1 || requests[0] != "DELETE /metrics/job/job1/instance/host1" {
+		t.Fatalf("pushgateway requests %v", requests)
+	}
+}
+
+func TestPusherKeepGroup(t *testing.T) {
+	pusher, gateway, closer := newTestPusher(t, &PushConfig{Interval: time.Hour, KeepGroup: true})
+	defer closer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := pusher.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	requests := gateway.Requests()
+	if len(requests) != 1 || requests[0] != "PUT /metrics/job/job1/instance/host1" {
+		t.Fatalf("pushgateway requests %v", requests)
+	}
+}
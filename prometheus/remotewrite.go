@@ -0,0 +1,390 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/eudore/eudore"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	// PrometheusRemoteWriteSamplesName 定义remote write发送成功样本数量的监控项名称
+	PrometheusRemoteWriteSamplesName = "remote_write_samples_total"
+	// PrometheusRemoteWriteSamplesHelp 定义remote write发送成功样本数量的监控项名称
+	PrometheusRemoteWriteSamplesHelp = "Total number of samples sent by remote write."
+	// PrometheusRemoteWriteFailuresName 定义remote write发送失败次数的监控项名称
+	PrometheusRemoteWriteFailuresName = "remote_write_failures_total"
+	// PrometheusRemoteWriteFailuresHelp 定义remote write发送失败次数的监控项名称
+	PrometheusRemoteWriteFailuresHelp = "Total number of remote write requests failed after retries."
+	// PrometheusRemoteWriteRetriesName 定义remote write重试次数的监控项名称
+	PrometheusRemoteWriteRetriesName = "remote_write_retries_total"
+	// PrometheusRemoteWriteRetriesHelp 定义remote write重试次数的监控项名称
+	PrometheusRemoteWriteRetriesHelp = "Total number of remote write request retries."
+	// PrometheusRemoteWriteDroppedName 定义remote write队列满丢弃次数的监控项名称
+	PrometheusRemoteWriteDroppedName = "remote_write_dropped_total"
+	// PrometheusRemoteWriteDroppedHelp 定义remote write队列满丢弃次数的监控项名称
+	PrometheusRemoteWriteDroppedHelp = "Total number of remote write requests dropped because the queue is full."
+	// PrometheusRemoteWriteQueueName 定义remote write队列长度的监控项名称
+	PrometheusRemoteWriteQueueName = "remote_write_queue_length"
+	// PrometheusRemoteWriteQueueHelp 定义remote write队列长度的监控项名称
+	PrometheusRemoteWriteQueueHelp = "Current number of remote write requests waiting to be sent."
+)
+
+// RemoteWriteConfig 定义remote write配置。
+//
+// URL为空时不发送；Interval定义采集间隔，默认15s；QueueSize定义最多等待发送的请求数量，默认10；
+// 发送失败时在MinBackoff和MaxBackoff之间指数退避，最多重试MaxRetries次。
+type RemoteWriteConfig struct {
+	URL         string            `json:"url" alias:"url"`
+	Interval    time.Duration     `json:"interval" alias:"interval"`
+	Timeout     time.Duration     `json:"timeout" alias:"timeout"`
+	QueueSize   int               `json:"queuesize" alias:"queuesize"`
+	MaxRetries  int               `json:"maxretries" alias:"maxretries"`
+	MinBackoff  time.Duration     `json:"minbackoff" alias:"minbackoff"`
+	MaxBackoff  time.Duration     `json:"maxbackoff" alias:"maxbackoff"`
+	BearerToken string            `json:"bearertoken" alias:"bearertoken"`
+	Headers     map[string]string `json:"headers" alias:"headers"`
+}
+
+// RemoteWriter 定义周期采集监控数据并使用remote write协议发送的对象。
+type RemoteWriter struct {
+	*RemoteWriteConfig
+	Gatherer prometheus.Gatherer
+	Client   *http.Client
+	Logger   eudore.Logger
+	queue    chan remoteWriteRequest
+	samples  prometheus.Counter
+	failures prometheus.Counter
+	retries  prometheus.Counter
+	dropped  prometheus.Counter
+}
+
+type remoteWriteRequest struct {
+	body    []byte
+	samples int
+}
+
+// NewRemoteWriter 函数使用config.RemoteWrite创建RemoteWriter，发送状态监控项注册到reg，
+// 监控项名称使用config.Namespace和config.Subsystem前缀。
+func NewRemoteWriter(gatherer prometheus.Gatherer, reg prometheus.Registerer, config *Config) *RemoteWriter {
+	rw := &config.RemoteWrite
+	if rw.Interval == 0 {
+		rw.Interval = 15 * time.Second
+	}
+	if rw.Timeout == 0 {
+		rw.Timeout = 10 * time.Second
+	}
+	if rw.QueueSize == 0 {
+		rw.QueueSize = 10
+	}
+	if rw.MaxRetries == 0 {
+		rw.MaxRetries = 3
+	}
+	if rw.MinBackoff == 0 {
+		rw.MinBackoff = 500 * time.Millisecond
+	}
+	if rw.MaxBackoff == 0 {
+		rw.MaxBackoff = 30 * time.Second
+	}
+	config.Namespace = eudore.GetString(config.Namespace, "prometheus")
+
+	newCounter := func(name, help string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: name, Help: help,
+		})
+	}
+	w := &RemoteWriter{
+		RemoteWriteConfig: rw,
+		Gatherer:          gatherer,
+		Client:            &http.Client{Timeout: rw.Timeout},
+		queue:             make(chan remoteWriteRequest, rw.QueueSize),
+		samples:           newCounter(PrometheusRemoteWriteSamplesName, PrometheusRemoteWriteSamplesHelp),
+		failures:          newCounter(PrometheusRemoteWriteFailuresName, PrometheusRemoteWriteFailuresHelp),
+		retries:           newCounter(PrometheusRemoteWriteRetriesName, PrometheusRemoteWriteRetriesHelp),
+		dropped:           newCounter(PrometheusRemoteWriteDroppedName, PrometheusRemoteWriteDroppedHelp),
+	}
+	queue := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: config.Namespace, Subsystem: config.Subsystem,
+		Name: PrometheusRemoteWriteQueueName, Help: PrometheusRemoteWriteQueueHelp,
+	}, func() float64 {
+		return float64(len(w.queue))
+	})
+	reg.MustRegister(w.samples, w.failures, w.retries, w.dropped, queue)
+	return w
+}
+
+// Run 方法周期采集并发送监控数据，ctx结束时采集最后一次数据并发送队列中剩余数据后返回，
+// 发送剩余数据最多等待Timeout，超时后停止重试并丢弃剩余数据。
+func (w *RemoteWriter) Run(ctx context.Context) error {
+	sendCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for req := range w.queue {
+			w.send(sendCtx, req)
+		}
+	}()
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.collect()
+		case <-ctx.Done():
+			w.collect()
+			close(w.queue)
+			timer := time.AfterFunc(w.Timeout, cancel)
+			<-done
+			timer.Stop()
+			return nil
+		}
+	}
+}
+
+// collect 方法采集数据加入发送队列，队列满时丢弃本次数据。
+func (w *RemoteWriter) collect() {
+	mfs, err := w.Gatherer.Gather()
+	if err != nil {
+		w.logf("prometheus remote write gather error: %v", err)
+		if len(mfs) == 0 {
+			return
+		}
+	}
+	body, samples := newRemoteWriteRequest(mfs, time.Now().UnixNano()/int64(time.Millisecond))
+	select {
+	case w.queue <- remoteWriteRequest{snappy.Encode(nil, body), samples}:
+	default:
+		w.dropped.Inc()
+	}
+}
+
+func (w *RemoteWriter) send(ctx context.Context, req remoteWriteRequest) {
+	if ctx.Err() != nil {
+		w.dropped.Inc()
+		return
+	}
+	backoff := w.MinBackoff
+	for i := 0; ; i++ {
+		retry, err := w.post(ctx, req.body)
+		if err == nil {
+			w.samples.Add(float64(req.samples))
+			return
+		}
+		if !retry || i >= w.MaxRetries || ctx.Err() != nil {
+			w.failures.Inc()
+			w.logf("prometheus remote write to %s error: %v", w.URL, err)
+			return
+		}
+		w.retries.Inc()
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			w.failures.Inc()
+			w.logf("prometheus remote write to %s error: %v", w.URL, err)
+			return
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > w.MaxBackoff {
+			backoff = w.MaxBackoff
+		}
+	}
+}
+
+// post 方法发送请求，返回错误是否可以重试。
+func (w *RemoteWriter) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.BearerToken)
+	}
+	for key, val := range w.Headers {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write response status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+func (w *RemoteWriter) logf(format string, args ...interface{}) {
+	if w.Logger != nil {
+		w.Logger.Warningf(format, args...)
+	}
+}
+
+// newRemoteWriteRequest 函数将监控数据编码成remote write WriteRequest protobuf，返回数据和样本数量。
+//
+// native histogram使用TimeSeries.histograms发送，接收端需要支持native histogram；
+// 同时存在classic分桶时也发送_bucket、_sum、_count样本。
+func newRemoteWriteRequest(mfs []*dto.MetricFamily, now int64) ([]byte, int) {
+	var body []byte
+	var samples int
+	appendSeries := func(name string, labels []*dto.LabelPair, extra []string, val float64, ts int64) {
+		body = protowire.AppendTag(body, 1, protowire.BytesType)
+		body = protowire.AppendBytes(body, newRemoteWriteSeries(name, labels, extra, val, ts))
+		samples++
+	}
+	appendHistogram := func(name string, labels []*dto.LabelPair, histogram *dto.Histogram, ts int64) {
+		series := newRemoteWriteLabels(name, labels, nil)
+		series = protowire.AppendTag(series, 4, protowire.BytesType)
+		series = protowire.AppendBytes(series, newRemoteWriteHistogram(histogram, ts))
+		body = protowire.AppendTag(body, 1, protowire.BytesType)
+		body = protowire.AppendBytes(body, series)
+		samples++
+	}
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.Metric {
+			ts := now
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				appendSeries(name, m.Label, nil, m.GetCounter().GetValue(), ts)
+			case dto.MetricType_GAUGE:
+				appendSeries(name, m.Label, nil, m.GetGauge().GetValue(), ts)
+			case dto.MetricType_UNTYPED:
+				appendSeries(name, m.Label, nil, m.GetUntyped().GetValue(), ts)
+			case dto.MetricType_SUMMARY:
+				summary := m.GetSummary()
+				for _, q := range summary.Quantile {
+					appendSeries(name, m.Label, []string{"quantile", formatFloat(q.GetQuantile())}, q.GetValue(), ts)
+				}
+				appendSeries(name+"_sum", m.Label, nil, summary.GetSampleSum(), ts)
+				appendSeries(name+"_count", m.Label, nil, float64(summary.GetSampleCount()), ts)
+			case dto.MetricType_HISTOGRAM:
+				histogram := m.GetHistogram()
+				// client_golang只在启用native histogram时设置Schema。
+				if histogram.Schema != nil {
+					appendHistogram(name, m.Label, histogram, ts)
+					if len(histogram.Bucket) == 0 {
+						continue
+					}
+				}
+				for _, b := range histogram.Bucket {
+					appendSeries(name+"_bucket", m.Label, []string{"le", formatFloat(b.GetUpperBound())}, float64(b.GetCumulativeCount()), ts)
+				}
+				appendSeries(name+"_bucket", m.Label, []string{"le", "+Inf"}, float64(histogram.GetSampleCount()), ts)
+				appendSeries(name+"_sum", m.Label, nil, histogram.GetSampleSum(), ts)
+				appendSeries(name+"_count", m.Label, nil, float64(histogram.GetSampleCount()), ts)
+			}
+		}
+	}
+	return body, samples
+}
+
+// newRemoteWriteSeries 函数编码一个样本的TimeSeries。
+func newRemoteWriteSeries(name string, pairs []*dto.LabelPair, extra []string, val float64, ts int64) []byte {
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(val))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(ts))
+	series := newRemoteWriteLabels(name, pairs, extra)
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	return protowire.AppendBytes(series, sample)
+}
+
+// newRemoteWriteLabels 函数编码TimeSeries的标签，标签按照名称排序。
+func newRemoteWriteLabels(name string, pairs []*dto.LabelPair, extra []string) []byte {
+	labels := make([][2]string, 0, len(pairs)+2)
+	labels = append(labels, [2]string{"__name__", name})
+	for _, pair := range pairs {
+		labels = append(labels, [2]string{pair.GetName(), pair.GetValue()})
+	}
+	if extra != nil {
+		labels = append(labels, [2]string{extra[0], extra[1]})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i][0] < labels[j][0]
+	})
+
+	var series []byte
+	for _, label := range labels {
+		var b []byte
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, label[0])
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, label[1])
+		series = protowire.AppendTag(series, 1, protowire.BytesType)
+		series = protowire.AppendBytes(series, b)
+	}
+	return series
+}
+
+// newRemoteWriteHistogram 函数编码native histogram，dto的span和delta与remote write格式相同。
+func newRemoteWriteHistogram(histogram *dto.Histogram, ts int64) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, histogram.GetSampleCount())
+	b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(histogram.GetSampleSum()))
+	b = protowire.AppendTag(b, 4, protowire.VarintType)
+	b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(histogram.GetSchema())))
+	b = protowire.AppendTag(b, 5, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(histogram.GetZeroThreshold()))
+	b = protowire.AppendTag(b, 6, protowire.VarintType)
+	b = protowire.AppendVarint(b, histogram.GetZeroCount())
+	b = appendRemoteWriteBuckets(b, 8, histogram.GetNegativeSpan(), histogram.GetNegativeDelta())
+	b = appendRemoteWriteBuckets(b, 11, histogram.GetPositiveSpan(), histogram.GetPositiveDelta())
+	b = protowire.AppendTag(b, 15, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(ts))
+}
+
+// appendRemoteWriteBuckets 函数编码native histogram的BucketSpan和packed sint64 delta，num为span字段编号。
+func appendRemoteWriteBuckets(b []byte, num protowire.Number, spans []*dto.BucketSpan, deltas []int64) []byte {
+	for _, span := range spans {
+		var s []byte
+		s = protowire.AppendTag(s, 1, protowire.VarintType)
+		s = protowire.AppendVarint(s, protowire.EncodeZigZag(int64(span.GetOffset())))
+		s = protowire.AppendTag(s, 2, protowire.VarintType)
+		s = protowire.AppendVarint(s, uint64(span.GetLength()))
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, s)
+	}
+	if len(deltas) > 0 {
+		var d []byte
+		for _, delta := range deltas {
+			d = protowire.AppendVarint(d, protowire.EncodeZigZag(delta))
+		}
+		b = protowire.AppendTag(b, num+1, protowire.BytesType)
+		b = protowire.AppendBytes(b, d)
+	}
+	return b
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
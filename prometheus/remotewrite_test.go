@@ -0,0 +1,367 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// remoteWriteSample 定义测试接收端解码的样本，Histogram为native histogram。
+type remoteWriteSample struct {
+	Labels    map[string]string
+	Value     float64
+	Time      int64
+	Histogram *remoteWriteHistogram
+}
+
+// remoteWriteHistogram 定义测试接收端解码的native histogram。
+type remoteWriteHistogram struct {
+	Count     uint64
+	Sum       float64
+	Schema    int32
+	ZeroCount uint64
+	Spans     [][2]int64
+	Deltas    []int64
+	Time      int64
+}
+
+// decodeRemoteWrite 函数解码snappy压缩的WriteRequest protobuf，在接收端协程中调用，返回错误不使用t.Fatal。
+func decodeRemoteWrite(body []byte) ([]remoteWriteSample, error) {
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("remote write snappy decode: %w", err)
+	}
+	var samples []remoteWriteSample
+	err = forEachField(data, func(num protowire.Number, val []byte, _ uint64) error {
+		if num != 1 {
+			return nil
+		}
+		sample := remoteWriteSample{Labels: make(map[string]string)}
+		err := forEachField(val, func(num protowire.Number, val []byte, _ uint64) error {
+			switch num {
+			case 1:
+				var name, value string
+				err := forEachField(val, func(num protowire.Number, val []byte, _ uint64) error {
+					if num == 1 {
+						name = string(val)
+					} else if num == 2 {
+						value = string(val)
+					}
+					return nil
+				})
+				sample.Labels[name] = value
+				return err
+			case 2:
+				return forEachField(val, func(num protowire.Number, _ []byte, v uint64) error {
+					if num == 1 {
+						sample.Value = math.Float64frombits(v)
+					} else if num == 2 {
+						sample.Time = int64(v)
+					}
+					return nil
+				})
+			case 4:
+				sample.Histogram = &remoteWriteHistogram{}
+				return decodeRemoteWriteHistogram(val, sample.Histogram)
+			}
+			return nil
+		})
+		samples = append(samples, sample)
+		return err
+	})
+	return samples, err
+}
+
+func decodeRemoteWriteHistogram(data []byte, h *remoteWriteHistogram) error {
+	return forEachField(data, func(num protowire.Number, val []byte, v uint64) error {
+		switch num {
+		case 1:
+			h.Count = v
+		case 3:
+			h.Sum = math.Float64frombits(v)
+		case 4:
+			h.Schema = int32(protowire.DecodeZigZag(v))
+		case 6:
+			h.ZeroCount = v
+		case 11:
+			var span [2]int64
+			err := forEachField(val, func(num protowire.Number, _ []byte, v uint64) error {
+				if num == 1 {
+					span[0] = protowire.DecodeZigZag(v)
+				} else if num == 2 {
+					span[1] = int64(v)
+				}
+				return nil
+			})
+			h.Spans = append(h.Spans, span)
+			return err
+		case 12:
+			for len(val) > 0 {
+				delta, n := protowire.ConsumeVarint(val)
+				if n < 0 {
+					return fmt.Errorf("remote write protobuf delta: %w", protowire.ParseError(n))
+				}
+				h.Deltas = append(h.Deltas, protowire.DecodeZigZag(delta))
+				val = val[n:]
+			}
+		case 15:
+			h.Time = int64(v)
+		}
+		return nil
+	})
+}
+
+func forEachField(data []byte, fn func(protowire.Number, []byte, uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("remote write protobuf tag: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+		var err error
+		switch typ {
+		case protowire.BytesType:
+			var val []byte
+			val, n = protowire.ConsumeBytes(data)
+			if n >= 0 {
+				err = fn(num, val, 0)
+			}
+		case protowire.Fixed64Type:
+			var val uint64
+			val, n = protowire.ConsumeFixed64(data)
+			if n >= 0 {
+				err = fn(num, nil, val)
+			}
+		case protowire.VarintType:
+			var val uint64
+			val, n = protowire.ConsumeVarint(data)
+			if n >= 0 {
+				err = fn(num, nil, val)
+			}
+		default:
+			return fmt.Errorf("remote write protobuf unexpected wire type %d", typ)
+		}
+		if n < 0 {
+			return fmt.Errorf("remote write protobuf field %d: %w", num, protowire.ParseError(n))
+		}
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// newRemoteWriteReceiver 函数创建remote write接收端，解码错误使用t.Errorf报告并发送nil，避免测试阻塞。
+func newRemoteWriteReceiver(t *testing.T, check func(*http.Request)) (*httptest.Server, chan []remoteWriteSample) {
+	received := make(chan []remoteWriteSample, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
+		body, _ := io.ReadAll(r.Body)
+		samples, err := decodeRemoteWrite(body)
+		if err != nil {
+			t.Errorf("remote write decode: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		received <- samples
+	}))
+	return srv, received
+}
+
+func newTestRemoteWriter(url string, config *Config, collectors ...prometheus.Collector) *RemoteWriter {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_requests_total", Help: "test"}, []string{"code"})
+	counter.WithLabelValues("200").Add(3)
+	reg.MustRegister(counter)
+	reg.MustRegister(collectors...)
+	config.RemoteWrite.URL = url
+	config.RemoteWrite.Interval = time.Hour
+	return NewRemoteWriter(reg, prometheus.NewRegistry(), config)
+}
+
+func getRemoteWriteSample(samples []remoteWriteSample, labels ...string) *remoteWriteSample {
+	for i := range samples {
+		match := true
+		for j := 0; j < len(labels); j += 2 {
+			match = match && samples[i].Labels[labels[j]] == labels[j+1]
+		}
+		if match {
+			return &samples[i]
+		}
+	}
+	return nil
+}
+
+func TestRemoteWriterReceiver(t *testing.T) {
+	srv, received := newRemoteWriteReceiver(t, func(r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" ||
+			r.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("remote write headers %v", r.Header)
+		}
+	})
+	defer srv.Close()
+
+	writer := newTestRemoteWriter(srv.URL, &Config{RemoteWrite: RemoteWriteConfig{BearerToken: "token"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writer.Run(ctx)
+
+	samples := <-received
+	sample := getRemoteWriteSample(samples, "__name__", "test_requests_total", "code", "200")
+	if sample == nil || sample.Value != 3 || sample.Time == 0 {
+		t.Fatalf("remote write sample %v in %v", sample, samples)
+	}
+}
+
+func TestRemoteWriterHistogram(t *testing.T) {
+	srv, received := newRemoteWriteReceiver(t, nil)
+	defer srv.Close()
+
+	classic := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "test_classic_seconds", Help: "test", Buckets: []float64{1, 2},
+	})
+	native := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "test_native_seconds", Help: "test", Buckets: []float64{1, 2}, NativeHistogramBucketFactor: 2,
+	})
+	nativeOnly := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "test_native_only_seconds", Help: "test", NativeHistogramBucketFactor: 2,
+	})
+	for _, val := range []float64{0.5, 1.5, 1.5, 3} {
+		classic.Observe(val)
+		native.Observe(val)
+		nativeOnly.Observe(val)
+	}
+	writer := newTestRemoteWriter(srv.URL, &Config{}, classic, native, nativeOnly)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writer.Run(ctx)
+	samples := <-received
+
+	for _, name := range []string{"test_classic_seconds", "test_native_seconds"} {
+		for _, expect := range []struct {
+			labels []string
+			value  float64
+		}{
+			{[]string{"__name__", name + "_bucket", "le", "1"}, 1},
+			{[]string{"__name__", name + "_bucket", "le", "2"}, 3},
+			{[]string{"__name__", name + "_bucket", "le", "+Inf"}, 4},
+			{[]string{"__name__", name + "_sum"}, 6.5},
+			{[]string{"__name__", name + "_count"}, 4},
+		} {
+			sample := getRemoteWriteSample(samples, expect.labels...)
+			if sample == nil || sample.Value != expect.value {
+				t.Errorf("remote write %v sample %v", expect.labels, sample)
+			}
+		}
+	}
+	if getRemoteWriteSample(samples, "__name__", "test_classic_seconds") != nil {
+		t.Error("remote write classic histogram has native sample")
+	}
+	if getRemoteWriteSample(samples, "__name__", "test_native_only_seconds_count") != nil {
+		t.Error("remote write native only histogram has classic sample")
+	}
+
+	for _, name := range []string{"test_native_seconds", "test_native_only_seconds"} {
+		sample := getRemoteWriteSample(samples, "__name__", name)
+		if sample == nil || sample.Histogram == nil {
+			t.Fatalf("remote write %s not found native histogram: %v", name, sample)
+		}
+		// factor 2使用schema 0，分桶边界为2的幂次，0.5、1.5、1.5、3分别在分桶-1、1、1、2，间隔较小的span合并。
+		h := sample.Histogram
+		var count int64
+		var counts []int64
+		for _, delta := range h.Deltas {
+			count += delta
+			counts = append(counts, count)
+		}
+		if h.Count != 4 || h.Sum != 6.5 || h.Schema != 0 || h.Time == 0 ||
+			fmt.Sprint(h.Spans) != "[[-1 4]]" || fmt.Sprint(counts) != "[1 0 2 1]" {
+			t.Errorf("remote write %s native histogram %+v counts %v", name, h, counts)
+		}
+	}
+}
+
+func TestRemoteWriterNamespace(t *testing.T) {
+	srv, received := newRemoteWriteReceiver(t, nil)
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	config := &Config{Namespace: "app", Subsystem: "api", RemoteWrite: RemoteWriteConfig{URL: srv.URL, Interval: time.Hour}}
+	writer := NewRemoteWriter(reg, reg, config)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writer.Run(ctx)
+	<-received
+
+	for _, name := range []string{
+		"app_api_remote_write_samples_total",
+		"app_api_remote_write_failures_total",
+		"app_api_remote_write_retries_total",
+		"app_api_remote_write_dropped_total",
+		"app_api_remote_write_queue_length",
+	} {
+		n, err := testutil.GatherAndCount(reg, name)
+		if err != nil || n != 1 {
+			t.Errorf("remote write metric %s count %d error %v", name, n, err)
+		}
+	}
+	if val := testutil.ToFloat64(writer.samples); val == 0 {
+		t.Error("remote write samples not recorded")
+	}
+}
+
+func TestRemoteWriterRetry(t *testing.T) {
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	writer := newTestRemoteWriter(srv.URL, &Config{RemoteWrite: RemoteWriteConfig{MinBackoff: time.Millisecond}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writer.Run(ctx)
+	if atomic.LoadInt32(&count) != 2 {
+		t.Fatalf("remote write requests %d", count)
+	}
+}
+
+func TestRemoteWriterShutdown(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	writer := newTestRemoteWriter(srv.URL, &Config{RemoteWrite: RemoteWriteConfig{
+		Timeout:    100 * time.Millisecond,
+		MaxRetries: 10,
+		MinBackoff: time.Second,
+		MaxBackoff: time.Second,
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	writer.Run(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("remote write shutdown take %s", elapsed)
+	}
+}
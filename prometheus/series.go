@@ -0,0 +1,42 @@
+package prometheus
+
+import (
+	"strings"
+	"sync"
+)
+
+// seriesLimiter 定义标签组合数量限制，超过上限的新组合不允许记录。
+type seriesLimiter struct {
+	sync.RWMutex
+	limit  int
+	series map[string]struct{}
+}
+
+func newSeriesLimiter(limit int) *seriesLimiter {
+	return &seriesLimiter{
+		limit:  limit,
+		series: make(map[string]struct{}),
+	}
+}
+
+// Allow 方法检查标签组合是否允许记录。
+func (l *seriesLimiter) Allow(vals []string) bool {
+	key := strings.Join(vals, "\xff")
+	l.RLock()
+	_, ok := l.series[key]
+	l.RUnlock()
+	if ok {
+		return true
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if _, ok := l.series[key]; ok {
+		return true
+	}
+	if len(l.series) >= l.limit {
+		return false
+	}
+	l.series[key] = struct{}{}
+	return true
+}
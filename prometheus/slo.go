@@ -0,0 +1,168 @@
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// PrometheusSLOTotalName 定义slo全部事件数量的监控项名称
+	PrometheusSLOTotalName = "slo_events_total"
+	// PrometheusSLOTotalHelp 定义slo全部事件数量的监控项名称
+	PrometheusSLOTotalHelp = "Total number of events counted by SLO."
+	// PrometheusSLOGoodName 定义slo达标事件数量的监控项名称
+	PrometheusSLOGoodName = "slo_good_events_total"
+	// PrometheusSLOGoodHelp 定义slo达标事件数量的监控项名称
+	PrometheusSLOGoodHelp = "Total number of good events counted by SLO."
+)
+
+// SLOConfig 定义一个slo，使用action参数匹配请求。
+//
+// Latency为0时为可用性slo，status小于500的请求达标；
+// 否则为延迟slo，status小于500且耗时不超过Latency的请求达标。
+// Objective定义达标比例，例如0.999。
+type SLOConfig struct {
+	Name      string        `json:"name" alias:"name"`
+	Action    string        `json:"action" alias:"action"`
+	Objective float64       `json:"objective" alias:"objective"`
+	Latency   time.Duration `json:"latency" alias:"latency"`
+}
+
+// sloBurnRate 定义多窗口燃烧率告警，长窗口和短窗口同时超过燃烧率时告警。
+type sloBurnRate struct {
+	Long     string
+	Short    string
+	Rate     float64
+	Severity string
+}
+
+var sloWindows = []string{"5m", "30m", "1h", "2h", "6h", "1d", "3d"}
+
+var sloBurnRates = []sloBurnRate{
+	{"1h", "5m", 14.4, "page"},
+	{"6h", "30m", 6, "page"},
+	{"1d", "2h", 3, "ticket"},
+	{"3d", "6h", 1, "ticket"},
+}
+
+type sloRecorder struct {
+	actions map[string][]SLOConfig
+	total   *prometheus.CounterVec
+	good    *prometheus.CounterVec
+}
+
+// checkSLOs 函数检查slo配置，slo名称为空时使用action，名称不能重复。
+func checkSLOs(slos []SLOConfig) error {
+	names := make(map[string]struct{}, len(slos))
+	for _, slo := range getSLOs(slos) {
+		if slo.Action == "" || slo.Objective <= 0 || slo.Objective >= 1 || slo.Latency < 0 {
+			return fmt.Errorf("prometheus slo '%s' action, objective or latency is invalid", slo.Name)
+		}
+		if _, ok := names[slo.Name]; ok {
+			return fmt.Errorf("prometheus slo '%s' is duplicate", slo.Name)
+		}
+		names[slo.Name] = struct{}{}
+	}
+	return nil
+}
+
+// getSLOs 函数返回设置默认名称的slo配置副本，不修改调用者的配置。
+func getSLOs(slos []SLOConfig) []SLOConfig {
+	copies := make([]SLOConfig, len(slos))
+	for i, slo := range slos {
+		if slo.Name == "" {
+			slo.Name = slo.Action
+		}
+		copies[i] = slo
+	}
+	return copies
+}
+
+func newSLORecorder(config *Config, service prometheus.Labels) (*sloRecorder, error) {
+	if len(config.SLOs) == 0 {
+		return nil, nil
+	}
+	err := checkSLOs(config.SLOs)
+	if err != nil {
+		return nil, err
+	}
+	r := &sloRecorder{
+		actions: make(map[string][]SLOConfig),
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: PrometheusSLOTotalName, Help: PrometheusSLOTotalHelp, ConstLabels: service,
+		}, []string{"slo", "action"}),
+		good: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: PrometheusSLOGoodName, Help: PrometheusSLOGoodHelp, ConstLabels: service,
+		}, []string{"slo", "action"}),
+	}
+	for _, slo := range getSLOs(config.SLOs) {
+		r.actions[slo.Action] = append(r.actions[slo.Action], slo)
+		// 初始化监控项，没有请求时也能计算比例。
+		r.total.WithLabelValues(slo.Name, slo.Action)
+		r.good.WithLabelValues(slo.Name, slo.Action)
+	}
+	return r, nil
+}
+
+// Record 方法记录请求的slo事件。
+func (r *sloRecorder) Record(action string, status int, elapsed time.Duration) {
+	if r == nil {
+		return
+	}
+	for _, slo := range r.actions[action] {
+		r.total.WithLabelValues(slo.Name, action).Inc()
+		if status < 500 && (slo.Latency == 0 || elapsed <= slo.Latency) {
+			r.good.WithLabelValues(slo.Name, action).Inc()
+		}
+	}
+}
+
+// NewSLORules 函数使用slo配置生成Prometheus记录规则和多窗口燃烧率告警规则yaml，
+// name为服务名称，规则使用service标签区分相同slo名称的服务。
+func NewSLORules(name string, config *Config) ([]byte, error) {
+	err := checkSLOs(config.SLOs)
+	if err != nil {
+		return nil, err
+	}
+	namespace := config.Namespace
+	if namespace == "" {
+		namespace = "prometheus"
+	}
+	total := prometheus.BuildFQName(namespace, config.Subsystem, PrometheusSLOTotalName)
+	good := prometheus.BuildFQName(namespace, config.Subsystem, PrometheusSLOGoodName)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("groups:\n")
+	for _, slo := range getSLOs(config.SLOs) {
+		selector := fmt.Sprintf(`{service=%q,slo=%q}`, name, slo.Name)
+		budget := strconv.FormatFloat(1-slo.Objective, 'g', 6, 64)
+		fmt.Fprintf(buf, "- name: slo-%s-%s\n  rules:\n", name, slo.Name)
+		for _, window := range sloWindows {
+			fmt.Fprintf(buf, "  - record: slo:sli_error:ratio_rate%s\n", window)
+			fmt.Fprintf(buf, "    expr: %q\n", fmt.Sprintf(
+				"1 - sum by (service, slo) (rate(%s%s[%s])) / sum by (service, slo) (rate(%s%s[%s]))",
+				good, selector, window, total, selector, window,
+			))
+			fmt.Fprintf(buf, "    labels:\n      service: %q\n      slo: %q\n", name, slo.Name)
+		}
+		for _, burn := range sloBurnRates {
+			rate := strconv.FormatFloat(burn.Rate, 'g', -1, 64)
+			fmt.Fprintf(buf, "  - alert: SLOErrorBudgetBurn\n")
+			fmt.Fprintf(buf, "    expr: %q\n", fmt.Sprintf(
+				"slo:sli_error:ratio_rate%s%s > (%s * %s) and slo:sli_error:ratio_rate%s%s > (%s * %s)",
+				burn.Long, selector, rate, budget, burn.Short, selector, rate, budget,
+			))
+			fmt.Fprintf(buf, "    labels:\n      service: %q\n      slo: %q\n      severity: %s\n      window: %s\n", name, slo.Name, burn.Severity, burn.Long)
+			fmt.Fprintf(buf, "    annotations:\n      summary: %q\n", fmt.Sprintf(
+				"Service %s SLO %s (action %s, objective %g) error budget burn rate over %s in %s", name, slo.Name, slo.Action, slo.Objective, rate, burn.Long,
+			))
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,93 @@
+package prometheus
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+func newTestSLOConfig() *Config {
+	return &Config{SLOs: []SLOConfig{
+		{Action: "user:User:Get", Objective: 0.999},
+		{Name: "user-get-latency", Action: "user:User:Get", Objective: 0.99, Latency: 300 * time.Millisecond},
+	}}
+}
+
+func TestSLORecorder(t *testing.T) {
+	config := newTestSLOConfig()
+	r, err := newSLORecorder(config, prometheus.Labels{"service": "endpoint"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.SLOs[0].Name != "" {
+		t.Errorf("slo config name is modified: %s", config.SLOs[0].Name)
+	}
+
+	r.Record("user:User:Get", 200, 100*time.Millisecond)
+	r.Record("user:User:Get", 404, 500*time.Millisecond)
+	r.Record("user:User:Get", 503, 10*time.Millisecond)
+	r.Record("user:User:List", 200, 10*time.Millisecond)
+	for _, expect := range []struct {
+		slo   string
+		total float64
+		good  float64
+	}{
+		{"user:User:Get", 3, 2},
+		{"user-get-latency", 3, 1},
+	} {
+		total := testutil.ToFloat64(r.total.WithLabelValues(expect.slo, "user:User:Get"))
+		good := testutil.ToFloat64(r.good.WithLabelValues(expect.slo, "user:User:Get"))
+		if total != expect.total || good != expect.good {
+			t.Errorf("slo %s total %v good %v", expect.slo, total, good)
+		}
+	}
+	if testutil.CollectAndCount(r.total) != 2 {
+		t.Errorf("slo total series %d", testutil.CollectAndCount(r.total))
+	}
+}
+
+func TestSLOConfigInvalid(t *testing.T) {
+	for name, slos := range map[string][]SLOConfig{
+		"action":    {{Name: "a", Objective: 0.99}},
+		"objective": {{Action: "a", Objective: 1}},
+		"latency":   {{Action: "a", Objective: 0.99, Latency: -time.Second}},
+		"duplicate": {{Action: "a", Objective: 0.99}, {Name: "a", Action: "b", Objective: 0.9}},
+	} {
+		_, err := NewPrometheusConfig(&Config{SLOs: slos})
+		if err == nil {
+			t.Errorf("%s slo not rejected by NewPrometheusConfig", name)
+		}
+		_, err = NewSLORules("endpoint", &Config{SLOs: slos})
+		if err == nil {
+			t.Errorf("%s slo not rejected by NewSLORules", name)
+		}
+	}
+}
+
+func TestSLORules(t *testing.T) {
+	data, err := NewSLORules("endpoint", newTestSLOConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := "testdata/slo_rules.yaml"
+	if *updateGolden {
+		err = os.WriteFile(golden, data, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, expect) {
+		t.Errorf("slo rules differ from %s:\n%s", golden, data)
+	}
+}
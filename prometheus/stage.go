@@ -0,0 +1,76 @@
+package prometheus
+
+import (
+	"io"
+	"time"
+
+	"github.com/eudore/eudore"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requestBody 定义记录读取大小的请求body。
+type requestBody struct {
+	io.ReadCloser
+	size int64
+}
+
+// responseWriter 定义记录首字节写入时间的响应。
+type responseWriter struct {
+	eudore.ResponseWriter
+	first time.Time
+}
+
+// stageTimer 定义请求处理函数的独占耗时记录，嵌套调用的处理函数耗时从上级处理函数中扣除。
+type stageTimer struct {
+	nested   time.Duration
+	observer prometheus.ObserverVec
+}
+
+func (body *requestBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.size += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if w.first.IsZero() {
+		w.first = time.Now()
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseWriter) WriteString(data string) (int, error) {
+	return w.Write([]byte(data))
+}
+
+// Flush 方法刷新响应，未写入数据时也作为首字节时间。
+func (w *responseWriter) Flush() {
+	if w.first.IsZero() {
+		w.first = time.Now()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// wrapHandlers 方法包装请求后续的处理函数，记录每个处理函数的独占耗时。
+func (t *stageTimer) wrapHandlers(ctx eudore.Context) {
+	index, handlers := ctx.GetHandler()
+	wraps := make(eudore.HandlerFuncs, len(handlers))
+	copy(wraps, handlers)
+	for i := index + 1; i < len(handlers); i++ {
+		wraps[i] = t.wrapHandler(handlers[i])
+	}
+	ctx.SetHandler(index, wraps)
+}
+
+func (t *stageTimer) wrapHandler(h eudore.HandlerFunc) eudore.HandlerFunc {
+	stage := h.String()
+	return func(ctx eudore.Context) {
+		parent := t.nested
+		t.nested = 0
+		now := time.Now()
+		h(ctx)
+		elapsed := time.Since(now)
+		t.observer.WithLabelValues(stage).Observe((elapsed - t.nested).Seconds())
+		t.nested = parent + elapsed
+	}
+}
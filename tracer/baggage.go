@@ -0,0 +1,104 @@
+package tracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+type contextKey struct {
+	name string
+}
+
+// ContextItemBaggageFields 定义请求选择的baggage数据的context key，用于日志字段和prometheus exemplar。
+var ContextItemBaggageFields = &contextKey{"baggage-fields"}
+
+// BaggageFieldSize 定义baggage复制到日志字段和exemplar时的最大长度。
+var BaggageFieldSize = 64
+
+// ErrBaggageNoSpan 定义context不存在span时设置baggage的错误。
+var ErrBaggageNoSpan = errors.New("endpoint tracer baggage context not found span")
+
+// BaggageConfig 定义baggage配置。
+//
+// Allows定义允许设置的baggage key，为空允许全部key；
+// MaxSize定义单个baggage值的最大长度，MaxTotal定义全部baggage的最大长度，为0时不限制。
+//
+// Fields定义复制到请求日志字段和prometheus exemplar标签的baggage key。
+type BaggageConfig struct {
+	Allows   []string `json:"allows" alias:"allows"`
+	MaxSize  int      `json:"maxsize" alias:"maxsize"`
+	MaxTotal int      `json:"maxtotal" alias:"maxtotal"`
+	Fields   []string `json:"fields" alias:"fields"`
+}
+
+// SetBaggage 函数设置context中span的baggage，baggage会传递给后续的下游请求。
+func SetBaggage(ctx context.Context, config *BaggageConfig, key, val string) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return ErrBaggageNoSpan
+	}
+	key = strings.ToLower(key)
+	if len(config.Allows) > 0 && !stringSliceIn(config.Allows, key) {
+		return fmt.Errorf("endpoint tracer baggage key '%s' is not allowed", key)
+	}
+	if config.MaxSize > 0 && len(val) > config.MaxSize {
+		return fmt.Errorf("endpoint tracer baggage '%s' size %d exceeds %d", key, len(val), config.MaxSize)
+	}
+	if config.MaxTotal > 0 {
+		total := len(key) + len(val)
+		span.Context().ForeachBaggageItem(func(k, v string) bool {
+			if k != key {
+				total += len(k) + len(v)
+			}
+			return true
+		})
+		if total > config.MaxTotal {
+			return fmt.Errorf("endpoint tracer baggage total size %d exceeds %d", total, config.MaxTotal)
+		}
+	}
+	span.SetBaggageItem(key, val)
+	return nil
+}
+
+// GetBaggage 函数返回context中span的baggage。
+func GetBaggage(ctx context.Context, key string) string {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+	return span.BaggageItem(strings.ToLower(key))
+}
+
+// GetBaggageFields 函数返回NewOpentracingHandler选择的baggage数据。
+func GetBaggageFields(ctx context.Context) map[string]string {
+	fields, _ := ctx.Value(ContextItemBaggageFields).(map[string]string)
+	return fields
+}
+
+// newBaggageFields 函数读取span中指定key的baggage，值超过BaggageFieldSize截断。
+func newBaggageFields(span opentracing.Span, keys []string) map[string]string {
+	fields := make(map[string]string, len(keys))
+	for _, key := range keys {
+		// baggage来自客户端，忽略非utf8值，按照字符边界截断。
+		val := span.BaggageItem(strings.ToLower(key))
+		if val == "" || !utf8.ValidString(val) {
+			continue
+		}
+		fields[key] = truncateString(val, BaggageFieldSize)
+	}
+	return fields
+}
+
+func stringSliceIn(strs []string, str string) bool {
+	for _, i := range strs {
+		if strings.ToLower(i) == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,384 @@
+package tracer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eudore/eudore"
+	"github.com/uber/jaeger-client-go"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// FileConfig 定义span写入本地文件的配置，每行一个json格式的SpanData。
+//
+// MaxSize和MaxAge定义文件轮转的大小和时间，为0时不轮转；
+// MaxBackups定义保留轮转文件的数量，默认10，小于0时不删除轮转文件。
+//
+// jaeger span先写入长度为QueueSize(默认1000)的队列，由后台协程批量写入文件，队列满时丢弃span。
+type FileConfig struct {
+	Path       string        `json:"path" alias:"path"`
+	MaxSize    int64         `json:"maxsize" alias:"maxsize"`
+	MaxAge     time.Duration `json:"maxage" alias:"maxage"`
+	MaxBackups int           `json:"maxbackups" alias:"maxbackups"`
+	QueueSize  int           `json:"queuesize" alias:"queuesize"`
+}
+
+// fileWriter 定义按照大小和时间轮转的文件写入。
+type fileWriter struct {
+	sync.Mutex
+	*FileConfig
+	Logger  eudore.Logger
+	file    *os.File
+	size    int64
+	created time.Time
+	// rotated和seq保存最后轮转的时间和下一个序号，clean删除旧文件后序号仍然递增。
+	rotated string
+	seq     int
+	queue   chan *SpanData
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	async   bool
+	dropped int64
+}
+
+// fileReporter 定义jaeger span写入文件的jaeger.Reporter。
+type fileReporter struct {
+	*fileWriter
+	ServiceName string
+}
+
+// fileExporter 定义opentelemetry span写入文件的sdktrace.SpanExporter。
+type fileExporter struct {
+	*fileWriter
+}
+
+// newFileConfig 函数读取Agent的file://前缀作为文件路径。
+func newFileConfig(config *Config) {
+	if strings.HasPrefix(config.Agent, "file://") {
+		config.File.Path = strings.TrimPrefix(config.Agent, "file://")
+	}
+}
+
+func newFileWriter(config *FileConfig, logger eudore.Logger) (*fileWriter, error) {
+	if config.MaxBackups == 0 {
+		config.MaxBackups = 10
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = 1000
+	}
+	w := &fileWriter{
+		FileConfig: config,
+		Logger:     logger,
+		queue:      make(chan *SpanData, config.QueueSize),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	err := os.MkdirAll(filepath.Dir(config.Path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return w, w.open()
+}
+
+// newFileReporter 函数创建异步写入文件的jaeger.Reporter。
+func newFileReporter(writer *fileWriter, service string) fileReporter {
+	writer.async = true
+	go writer.run()
+	return fileReporter{writer, service}
+}
+
+func (w *fileWriter) open() error {
+	file, err := os.OpenFile(w.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = stat.Size()
+	w.created = time.Now()
+	return nil
+}
+
+// rotate 方法将当前文件重命名为带有时间的轮转文件，同一毫秒内多次轮转时添加-1、-2序号后缀。
+func (w *fileWriter) rotate() error {
+	w.file.Close()
+	ext := filepath.Ext(w.Path)
+	now := time.Now().Format("20060102150405.000")
+	if now != w.rotated {
+		w.rotated, w.seq = now, 0
+	}
+	prefix := fmt.Sprintf("%s-%s", strings.TrimSuffix(w.Path, ext), now)
+	var name string
+	for ; ; w.seq++ {
+		name = prefix + ext
+		if w.seq > 0 {
+			name = fmt.Sprintf("%s-%d%s", prefix, w.seq, ext)
+		}
+		_, err := os.Lstat(name)
+		if os.IsNotExist(err) {
+			break
+		}
+	}
+	err := os.Rename(w.Path, name)
+	if err != nil {
+		return err
+	}
+	w.seq++
+	w.clean()
+	return w.open()
+}
+
+// clean 方法删除超过MaxBackups数量的旧轮转文件。
+func (w *fileWriter) clean() {
+	if w.MaxBackups < 0 {
+		return
+	}
+	ext := filepath.Ext(w.Path)
+	names, err := filepath.Glob(strings.TrimSuffix(w.Path, ext) + "-*" + ext)
+	if err != nil || len(names) <= w.MaxBackups {
+		return
+	}
+	// 轮转文件名称包含时间和序号，按照时间和序号排序。
+	prefix, size := len(strings.TrimSuffix(w.Path, ext))+1, len("20060102150405.000")
+	sort.Slice(names, func(i, j int) bool {
+		ti, si := getFileBackupOrder(names[i], prefix, size, ext)
+		tj, sj := getFileBackupOrder(names[j], prefix, size, ext)
+		if ti != tj {
+			return ti < tj
+		}
+		return si < sj
+	})
+	for _, name := range names[:len(names)-w.MaxBackups] {
+		err = os.Remove(name)
+		if err != nil {
+			w.logf("tracer file remove backup %s error: %v", name, err)
+		}
+	}
+}
+
+// getFileBackupOrder 函数返回轮转文件名称中的时间和序号。
+func getFileBackupOrder(name string, prefix, size int, ext string) (string, int) {
+	name = strings.TrimSuffix(name[prefix:], ext)
+	if len(name) <= size {
+		return name, 0
+	}
+	seq, _ := strconv.Atoi(strings.TrimPrefix(name[size:], "-"))
+	return name[:size], seq
+}
+
+// Push 方法将span加入写入队列，队列满时丢弃span，不阻塞请求。
+func (w *fileWriter) Push(span *SpanData) {
+	select {
+	case w.queue <- span:
+	default:
+		atomic.AddInt64(&w.dropped, 1)
+	}
+}
+
+// run 方法批量写入队列中的span，关闭时写入剩余span。
+func (w *fileWriter) run() {
+	defer close(w.done)
+	spans := make([]*SpanData, 0, 100)
+	for {
+		select {
+		case span := <-w.queue:
+			spans = append(spans, span)
+		case <-w.stop:
+			for len(w.queue) > 0 {
+				spans = append(spans, <-w.queue)
+			}
+			w.flush(spans)
+			return
+		}
+		for len(spans) < cap(spans) && len(w.queue) > 0 {
+			spans = append(spans, <-w.queue)
+		}
+		w.flush(spans)
+		spans = spans[:0]
+	}
+}
+
+func (w *fileWriter) flush(spans []*SpanData) {
+	if len(spans) > 0 {
+		err := w.WriteSpans(spans...)
+		if err != nil {
+			w.logf("tracer file write %d spans error: %v", len(spans), err)
+		}
+	}
+	if dropped := atomic.SwapInt64(&w.dropped, 0); dropped > 0 {
+		w.logf("tracer file queue is full, dropped %d spans", dropped)
+	}
+}
+
+func (w *fileWriter) logf(format string, args ...interface{}) {
+	if w.Logger != nil {
+		w.Logger.Errorf(format, args...)
+	}
+}
+
+// WriteSpans 方法将span写入文件，一个span一行。
+func (w *fileWriter) WriteSpans(spans ...*SpanData) error {
+	var body []byte
+	for _, span := range spans {
+		line, err := json.Marshal(span)
+		if err != nil {
+			return err
+		}
+		body = append(append(body, line...), '\n')
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	if (w.MaxSize > 0 && w.size+int64(len(body)) > w.MaxSize && w.size > 0) ||
+		(w.MaxAge > 0 && time.Since(w.created) > w.MaxAge) {
+		err := w.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(body)
+	w.size += int64(n)
+	return err
+}
+
+// Close 方法停止后台写入协程并关闭文件。
+func (w *fileWriter) Close() error {
+	w.once.Do(func() {
+		close(w.stop)
+		if w.async {
+			<-w.done
+		}
+	})
+	w.Lock()
+	defer w.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (r fileReporter) Report(span *jaeger.Span) {
+	r.Push(newSpanDataJaeger(span, r.ServiceName))
+}
+
+func (r fileReporter) Close() {
+	r.fileWriter.Close()
+}
+
+func (e fileExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	datas := make([]*SpanData, len(spans))
+	for i := range spans {
+		datas[i] = newSpanDataOpentelemetry(spans[i])
+	}
+	return e.WriteSpans(datas...)
+}
+
+func (e fileExporter) Shutdown(context.Context) error {
+	return e.Close()
+}
+
+// NewSpanDataOTLP 函数将SpanData转换成OTLP/JSON格式，可以发送到OTLP http接收端/v1/traces。
+func NewSpanDataOTLP(spans []*SpanData) ([]byte, error) {
+	type otlpSpans struct {
+		Scope map[string]string        `json:"scope"`
+		Spans []map[string]interface{} `json:"spans"`
+	}
+	type otlpResource struct {
+		Resource   map[string]interface{} `json:"resource"`
+		ScopeSpans []*otlpSpans           `json:"scopeSpans"`
+	}
+
+	var resources []*otlpResource
+	services := make(map[string]*otlpSpans)
+	for _, span := range spans {
+		scope, ok := services[span.Process.ServiceName]
+		if !ok {
+			scope = &otlpSpans{Scope: map[string]string{"name": "github.com/eudore/endpoint/tracer"}}
+			services[span.Process.ServiceName] = scope
+			resources = append(resources, &otlpResource{
+				Resource: map[string]interface{}{
+					"attributes": newOTLPAttributes([]SpanKeyValue{newSpanKeyValue("service.name", span.Process.ServiceName)}),
+				},
+				ScopeSpans: []*otlpSpans{scope},
+			})
+		}
+
+		data := map[string]interface{}{
+			"traceId":           fmt.Sprintf("%032s", span.TraceID),
+			"spanId":            fmt.Sprintf("%016s", span.SpanID),
+			"name":              span.OperationName,
+			"kind":              otlpSpanKind[fmt.Sprint(span.GetTag("span.kind"))],
+			"startTimeUnixNano": strconv.FormatInt(span.StartTime*1e3, 10),
+			"endTimeUnixNano":   strconv.FormatInt((span.StartTime+span.Duration)*1e3, 10),
+			"attributes":        newOTLPAttributes(span.Tags),
+		}
+		if parent := span.GetParentID(); parent != "" {
+			data["parentSpanId"] = fmt.Sprintf("%016s", parent)
+		}
+		if span.GetTag("error") == true {
+			data["status"] = map[string]int{"code": 2}
+		}
+		events := make([]map[string]interface{}, len(span.Logs))
+		for i, log := range span.Logs {
+			events[i] = map[string]interface{}{
+				"timeUnixNano": strconv.FormatInt(log.Timestamp*1e3, 10),
+				"name":         "log",
+				"attributes":   newOTLPAttributes(log.Fields),
+			}
+		}
+		data["events"] = events
+		scope.Spans = append(scope.Spans, data)
+	}
+	return json.Marshal(map[string]interface{}{"resourceSpans": resources})
+}
+
+var otlpSpanKind = map[string]int{
+	"internal": 1,
+	"server":   2,
+	"client":   3,
+	"producer": 4,
+	"consumer": 5,
+}
+
+func newOTLPAttributes(kvs []SpanKeyValue) []map[string]interface{} {
+	attrs := make([]map[string]interface{}, len(kvs))
+	for i, kv := range kvs {
+		var val map[string]interface{}
+		switch kv.Type {
+		case "bool":
+			val = map[string]interface{}{"boolValue": kv.Value}
+		case "int64":
+			// 从文件读取的json数字为float64类型
+			if f, ok := kv.Value.(float64); ok {
+				val = map[string]interface{}{"intValue": strconv.FormatFloat(f, 'f', 0, 64)}
+			} else {
+				val = map[string]interface{}{"intValue": fmt.Sprint(kv.Value)}
+			}
+		case "float64":
+			val = map[string]interface{}{"doubleValue": kv.Value}
+		default:
+			val = map[string]interface{}{"stringValue": fmt.Sprint(kv.Value)}
+		}
+		attrs[i] = map[string]interface{}{"key": kv.Key, "value": val}
+	}
+	return attrs
+}
@@ -0,0 +1,156 @@
+package tracer
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getFileSpanIDs 函数读取span文件中的span id。
+func getFileSpanIDs(t *testing.T, name string) string {
+	t.Helper()
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var ids []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		span := &SpanData{}
+		err = json.Unmarshal(scanner.Bytes(), span)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, span.SpanID)
+	}
+	return strings.Join(ids, ",")
+}
+
+// getFileBackups 函数返回按照轮转顺序排序的轮转文件中的span id。
+func getFileBackups(t *testing.T, path string) []string {
+	t.Helper()
+	names, err := filepath.Glob(strings.TrimSuffix(path, ".log") + "-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(names))
+	for i := range names {
+		ids[i] = getFileSpanIDs(t, names[i])
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestFileWriterSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.log")
+	w, err := newFileWriter(&FileConfig{Path: path, MaxSize: 1, MaxBackups: -1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	// 同一毫秒内多次轮转不能覆盖轮转文件。
+	for _, id := range []string{"s0", "s1", "s2", "s3", "s4"} {
+		err = w.WriteSpans(newRecentSpan("t1", id, "", "", 0, 0, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(getFileBackups(t, path), ";"); got != "s0;s1;s2;s3" {
+		t.Errorf("file size rotate backups %s", got)
+	}
+	if got := getFileSpanIDs(t, path); got != "s4" {
+		t.Errorf("file size rotate current %s", got)
+	}
+
+	// 文件没有超过MaxSize不轮转。
+	path = filepath.Join(t.TempDir(), "spans.log")
+	w, err = newFileWriter(&FileConfig{Path: path, MaxSize: 1 << 20}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.WriteSpans(newRecentSpan("t1", "s0", "", "", 0, 0, 0))
+	w.WriteSpans(newRecentSpan("t1", "s1", "", "", 0, 0, 0))
+	if got := getFileBackups(t, path); len(got) != 0 || getFileSpanIDs(t, path) != "s0,s1" {
+		t.Errorf("file size not rotate backups %v", got)
+	}
+}
+
+func TestFileWriterAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.log")
+	w, err := newFileWriter(&FileConfig{Path: path, MaxAge: time.Hour}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.WriteSpans(newRecentSpan("t1", "s0", "", "", 0, 0, 0))
+	w.WriteSpans(newRecentSpan("t1", "s1", "", "", 0, 0, 0))
+	w.created = time.Now().Add(-2 * time.Hour)
+	w.WriteSpans(newRecentSpan("t1", "s2", "", "", 0, 0, 0))
+	if got := strings.Join(getFileBackups(t, path), ";"); got != "s0,s1" {
+		t.Errorf("file age rotate backups %s", got)
+	}
+	if got := getFileSpanIDs(t, path); got != "s2" {
+		t.Errorf("file age rotate current %s", got)
+	}
+}
+
+func TestFileWriterClean(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.log")
+	w, err := newFileWriter(&FileConfig{Path: path, MaxSize: 1, MaxBackups: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, id := range []string{"s0", "s1", "s2", "s3", "s4"} {
+		w.WriteSpans(newRecentSpan("t1", id, "", "", 0, 0, 0))
+	}
+	// 删除最早的轮转文件，包括同一毫秒内带有序号的轮转文件。
+	if got := strings.Join(getFileBackups(t, path), ";"); got != "s2;s3" {
+		t.Errorf("file clean backups %s", got)
+	}
+
+	dir := t.TempDir()
+	for i, name := range []string{
+		"spans-20220102150405.000-10.log",
+		"spans-20220102150405.000-2.log",
+		"spans-20220102150405.000.log",
+		"spans-20220102150405.001.log",
+		"spans-20220102150404.999-1.log",
+	} {
+		os.WriteFile(filepath.Join(dir, name), []byte{byte('0' + i)}, 0644)
+	}
+	w = &fileWriter{FileConfig: &FileConfig{Path: filepath.Join(dir, "spans.log"), MaxBackups: 2}}
+	w.clean()
+	names, _ := filepath.Glob(filepath.Join(dir, "spans-*.log"))
+	for i := range names {
+		names[i] = filepath.Base(names[i])
+	}
+	if got := strings.Join(names, ","); got != "spans-20220102150405.000-10.log,spans-20220102150405.001.log" {
+		t.Errorf("file clean order %s", got)
+	}
+}
+
+func TestFileWriterClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.log")
+	w, err := newFileWriter(&FileConfig{Path: path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter := newFileReporter(w, "test")
+	reporter.Push(newRecentSpan("t1", "s0", "", "", 0, 0, 0))
+	reporter.Push(newRecentSpan("t1", "s1", "", "", 0, 0, 0))
+	reporter.Close()
+	if got := getFileSpanIDs(t, path); got != "s0,s1" {
+		t.Errorf("file close flush %s", got)
+	}
+	if err := w.WriteSpans(newRecentSpan("t1", "s2", "", "", 0, 0, 0)); err != os.ErrClosed {
+		t.Errorf("file write after close error %v", err)
+	}
+}
@@ -45,10 +45,15 @@ func (trace httpTrace) RoundTrip(req *http.Request) (*http.Response, error) {
 	if req.URL.RawQuery != "" {
 		span.SetTag("http.row", req.URL.RawQuery)
 	}
+	if attempt, ok := req.Context().Value(ContextItemHTTPAttempt).(int); ok {
+		span.SetTag("http.attempt", attempt)
+	}
 	serviceId := req.Header.Get("X-Service-Id")
 	if serviceId != "" {
 		span.SetTag("http.service", serviceId)
 	}
+	// RoundTripper不能修改原始请求，复制header后注入span和baggage。
+	req = req.Clone(req.Context())
 	spanParent.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
 
 	resp, err := trace.next.RoundTrip(req)
@@ -2,10 +2,13 @@ package tracer
 
 import (
 	"context"
+	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/eudore/eudore"
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/opentracing/opentracing-go/log"
 )
 
@@ -21,8 +24,13 @@ func (log traceLogger) Infof(msg string, args ...interface{}) {
 	log.Logger.Infof(msg, args...)
 }
 
+// LoggerFieldSize 定义日志写入span时默认的字段最大长度。
+var LoggerFieldSize = 1024
+
 type loggerStdDataTrace struct {
 	eudore.LoggerStdData
+	Level     eudore.LoggerLevel
+	FieldSize int
 }
 
 // NewOpentracingLogger 函数创建同时写入opentraing的eudore.Logger。
@@ -32,17 +40,26 @@ func NewOpentracingLogger() eudore.Logger {
 
 // NewOpentracingLoggerStdData 函数指定eudore.LoggerStdData创建同时写入opentraing的eudore.Logger。
 func NewOpentracingLoggerStdData(data eudore.LoggerStdData) eudore.LoggerStdData {
+	return NewOpentracingLoggerStdDataConfig(data, &Config{})
+}
+
+// NewOpentracingLoggerStdDataConfig 函数创建同时写入opentraing的eudore.Logger，
+// 使用配置的LoggerLevel和LoggerFieldSize定义写入span的最低日志级别和字段最大长度。
+func NewOpentracingLoggerStdDataConfig(data eudore.LoggerStdData, config *Config) eudore.LoggerStdData {
 	if data == nil {
 		data = eudore.NewLoggerStdDataJSON(nil)
 	}
-	return loggerStdDataTrace{data}
+	if config.LoggerFieldSize == 0 {
+		config.LoggerFieldSize = LoggerFieldSize
+	}
+	return loggerStdDataTrace{data, config.LoggerLevel, config.LoggerFieldSize}
 }
 
 func (data loggerStdDataTrace) GetLogger() *eudore.LoggerStd {
 	log := data.LoggerStdData.GetLogger()
 	_, ok := log.LoggerStdData.(loggerStdDataTrace)
 	if !ok {
-		log.LoggerStdData = loggerStdDataTrace{log.LoggerStdData}
+		log.LoggerStdData = loggerStdDataTrace{log.LoggerStdData, data.Level, data.FieldSize}
 	}
 	return log
 }
@@ -54,18 +71,73 @@ func (data loggerStdDataTrace) PutLogger(l *eudore.LoggerStd) {
 			if ok {
 				l.Keys = append(l.Keys[:i], l.Keys[i+1:]...)
 				l.Vals = append(l.Vals[:i], l.Vals[i+1:]...)
-				fields := make([]log.Field, 0, len(l.Keys)+1)
-				for i := 0; i < len(l.Keys); i++ {
-					if !strings.HasPrefix(l.Keys[i], "x-") {
-						fields = append(fields, log.Object(l.Keys[i], l.Vals[i]))
-					}
+				span := opentracing.SpanFromContext(ctx)
+				if span != nil && l.Level >= data.Level {
+					data.logSpan(span, l)
 				}
-				fields = append(fields, log.String("level", l.Level.String()), log.String("message", l.Message))
-				// TODO: check nil
-				opentracing.SpanFromContext(ctx).LogFields(fields...)
 				break
 			}
 		}
 	}
 	data.LoggerStdData.PutLogger(l)
 }
+
+// logSpan 方法将日志写入span，Error级别以上的日志设置span error。
+func (data loggerStdDataTrace) logSpan(span opentracing.Span, l *eudore.LoggerStd) {
+	fields := make([]log.Field, 0, len(l.Keys)+2)
+	for i := 0; i < len(l.Keys); i++ {
+		if !strings.HasPrefix(l.Keys[i], "x-") {
+			fields = append(fields, data.newField(l.Keys[i], l.Vals[i]))
+		}
+	}
+	fields = append(fields, log.String("level", l.Level.String()), data.newField("message", l.Message))
+	if l.Level >= eudore.LogError {
+		ext.Error.Set(span, true)
+	}
+	span.LogFields(fields...)
+}
+
+// newField 方法创建日志字段，超过FieldSize的字段值截断。
+func (data loggerStdDataTrace) newField(key string, val interface{}) log.Field {
+	switch v := val.(type) {
+	case bool:
+		return log.Bool(key, v)
+	case int:
+		return log.Int(key, v)
+	case int64:
+		return log.Int64(key, v)
+	case float64:
+		return log.Float64(key, v)
+	case string:
+		return log.String(key, data.truncate(v))
+	default:
+		return log.String(key, data.truncate(fmt.Sprint(v)))
+	}
+}
+
+func (data loggerStdDataTrace) truncate(str string) string {
+	if data.FieldSize > 0 && len(str) > data.FieldSize {
+		return truncateString(str, data.FieldSize) + "..."
+	}
+	return str
+}
+
+// truncateString 函数截断字符串到最多size字节，截断位置回退到utf8字符边界。
+func truncateString(str string, size int) string {
+	if len(str) <= size {
+		return str
+	}
+	for size > 0 && !utf8.RuneStart(str[size]) {
+		size--
+	}
+	return str[:size]
+}
+
+// NewSpan 函数创建context中span的子span，context不存在span时使用opentracing.GlobalTracer创建。
+func NewSpan(ctx context.Context, operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	parent := opentracing.SpanFromContext(ctx)
+	if parent == nil {
+		return opentracing.GlobalTracer().StartSpan(operationName, opts...)
+	}
+	return parent.Tracer().StartSpan(operationName, append(opts, opentracing.ChildOf(parent.Context()))...)
+}
@@ -0,0 +1,56 @@
+package tracer
+
+import (
+	"fmt"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// MockTracer 定义别名 mocktracer.MockTracer
+type MockTracer = mocktracer.MockTracer
+
+// MockSpan 定义别名 mocktracer.MockSpan
+type MockSpan = mocktracer.MockSpan
+
+// NewMockTracer 函数创建在内存记录span的Tracer，用于无网络环境测试。
+func NewMockTracer() *MockTracer {
+	return mocktracer.New()
+}
+
+// GetMockSpans 函数返回MockTracer指定名称的已完成span，operation为空返回全部span。
+func GetMockSpans(tracer Tracer, operation string) []*MockSpan {
+	mock, ok := tracer.(*MockTracer)
+	if !ok {
+		return nil
+	}
+	var spans []*MockSpan
+	for _, span := range mock.FinishedSpans() {
+		if operation == "" || span.OperationName == operation {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// IsMockChildOf 函数判断span是否是parent的子span。
+func IsMockChildOf(span, parent *MockSpan) bool {
+	return span.SpanContext.TraceID == parent.SpanContext.TraceID && span.ParentID == parent.SpanContext.SpanID
+}
+
+// HasMockTag 函数判断span是否存在指定tag。
+func HasMockTag(span *MockSpan, key string, val interface{}) bool {
+	tag := span.Tag(key)
+	return tag != nil && fmt.Sprint(tag) == fmt.Sprint(val)
+}
+
+// HasMockLog 函数判断span是否存在指定日志字段。
+func HasMockLog(span *MockSpan, key string, val interface{}) bool {
+	for _, record := range span.Logs() {
+		for _, field := range record.Fields {
+			if field.Key == key && field.ValueString == fmt.Sprint(val) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package tracer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+func TestMockHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Mockpfx-Ids-Traceid") == "" {
+			t.Errorf("http client not inject span context: %v", r.Header)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	tracer := NewMockTracer()
+	parent := tracer.StartSpan("parent")
+	req, _ := http.NewRequestWithContext(opentracing.ContextWithSpan(context.Background(), parent),
+		http.MethodGet, srv.URL+"/api?id=1", nil)
+	req.Header.Set("X-Service-Id", "backend")
+	resp, err := NewOpentracingHTTPClient(&http.Client{}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.Finish()
+
+	spans := GetMockSpans(tracer, "http.client")
+	if len(spans) != 1 {
+		t.Fatalf("http.client spans %d", len(spans))
+	}
+	span := spans[0]
+	if !IsMockChildOf(span, GetMockSpans(tracer, "parent")[0]) {
+		t.Error("http.client span is not child of parent")
+	}
+	for key, val := range map[string]interface{}{
+		"span.kind":    "client",
+		"http.method":  http.MethodGet,
+		"http.path":    "/api",
+		"http.row":     "id=1",
+		"http.service": "backend",
+		"http.status":  http.StatusAccepted,
+	} {
+		if !HasMockTag(span, key, val) {
+			t.Errorf("http.client span tag %s=%v, got %v", key, val, span.Tag(key))
+		}
+	}
+}
+
+func TestMockHTTPClientError(t *testing.T) {
+	tracer := NewMockTracer()
+	parent := tracer.StartSpan("parent")
+	req, _ := http.NewRequestWithContext(opentracing.ContextWithSpan(context.Background(), parent),
+		http.MethodGet, "http://127.0.0.1:1/", nil)
+	_, err := NewOpentracingHTTPClient(&http.Client{}).Do(req)
+	if err == nil {
+		t.Fatal("http client want error")
+	}
+	spans := GetMockSpans(tracer, "http.client")
+	if len(spans) != 1 || len(spans[0].Logs()) == 0 {
+		t.Fatalf("http.client span not log error: %v", spans)
+	}
+}
+
+func TestMockHTTPClientNoSpan(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Mockpfx-Ids-Traceid") != "" {
+			t.Errorf("http client without parent span inject span context: %v", r.Header)
+		}
+	}))
+	defer srv.Close()
+
+	// 全局tracer和其他context中的span都不能用于没有父span的请求。
+	tracer := NewMockTracer()
+	global := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(global)
+	sibling := tracer.StartSpan("sibling")
+
+	resp, err := NewOpentracingHTTPClient(&http.Client{}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	sibling.Finish()
+	if spans := GetMockSpans(tracer, ""); len(spans) != 1 || spans[0].OperationName != "sibling" {
+		t.Errorf("http client without parent span create span: %v", spans)
+	}
+	if len(GetMockSpans(tracer, "http.client")) != 0 {
+		t.Error("http client without parent span create http.client span")
+	}
+}
@@ -0,0 +1,190 @@
+package tracer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/eudore/eudore"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// otelTracer 定义opentelemetry实现的opentracing.Tracer，Close方法刷新未发送的span。
+type otelTracer struct {
+	*otelbridge.BridgeTracer
+	Provider *sdktrace.TracerProvider
+}
+
+// otelSampler 定义按照span名称(action参数)选择的采样器，sampling.priority属性强制采样。
+type otelSampler struct {
+	sdktrace.Sampler
+	Routes map[string]sdktrace.Sampler
+}
+
+// otelSamplerRateLimiting 定义opentelemetry限流采样器。
+type otelSamplerRateLimiting struct {
+	utils.RateLimiter
+	Param float64
+}
+
+// NewOpentelemetry 函数使用配置创建opentelemetry实现的Tracer，
+// 通过opentracing bridge兼容opentracing api。
+func NewOpentelemetry(config *Config) (opentracing.Tracer, error) {
+	exporter, err := newOpentelemetryExporter(config)
+	if err != nil {
+		return nil, err
+	}
+	sampler, err := newOpentelemetrySampler(config)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Propagators) == 0 {
+		config.Propagators = []string{"w3c"}
+	}
+	propagator, err := newOpentelemetryPropagator(config.Propagators, sampler)
+	if err != nil {
+		return nil, err
+	}
+
+	var processor sdktrace.SpanProcessor = sdktrace.NewBatchSpanProcessor(exporter)
+	if config.Sampler.Type == SamplerTypeTail {
+		// 尾部采样不使用上游采样决定，全部span缓存后决定。
+		processor = tailProcessor{newTailBuffer(&config.Sampler), processor}
+	} else {
+		sampler = sdktrace.ParentBased(sampler)
+	}
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", config.ServiceName))),
+	}
+	if config.RecentTraces != nil {
+		options = append(options, sdktrace.WithSpanProcessor(recentProcessor{config.RecentTraces}))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+	bridge, wrapper := otelbridge.NewTracerPair(provider.Tracer("github.com/eudore/endpoint/tracer"))
+	bridge.SetTextMapPropagator(propagator)
+	if config.Logger != nil {
+		bridge.SetWarningHandler(func(msg string) {
+			config.Logger.Warning(msg)
+		})
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			config.Logger.Error(err)
+		}))
+	}
+	otel.SetTracerProvider(wrapper)
+	return otelTracer{bridge, provider}, nil
+}
+
+func newOpentelemetryExporter(config *Config) (sdktrace.SpanExporter, error) {
+	if config.File.Path != "" {
+		writer, err := newFileWriter(&config.File, config.Logger)
+		if err != nil {
+			return nil, err
+		}
+		return fileExporter{writer}, nil
+	}
+	config.Protocol = eudore.GetString(config.Protocol, "grpc")
+	switch config.Protocol {
+	case "grpc":
+		config.Agent = eudore.GetString(config.Agent, "127.0.0.1:4317")
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.Agent)}
+		if config.Insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(context.Background(), options...)
+	case "http":
+		config.Agent = eudore.GetString(config.Agent, "127.0.0.1:4318")
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.Agent)}
+		if config.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(context.Background(), options...)
+	default:
+		return nil, fmt.Errorf("未定义OTLP协议：'%s'", config.Protocol)
+	}
+}
+
+func newOpentelemetrySampler(config *Config) (sdktrace.Sampler, error) {
+	if config.Sampler.Type == "" {
+		config.Sampler.Type = jaeger.SamplerTypeConst
+		config.Sampler.Param = 1
+	}
+
+	var sampler sdktrace.Sampler
+	switch config.Sampler.Type {
+	case jaeger.SamplerTypeConst:
+		sampler = sdktrace.NeverSample()
+		if config.Sampler.Param != 0 {
+			sampler = sdktrace.AlwaysSample()
+		}
+	case SamplerTypeTail:
+		return sdktrace.AlwaysSample(), nil
+	case jaeger.SamplerTypeProbabilistic:
+		sampler = sdktrace.TraceIDRatioBased(config.Sampler.Param)
+	case jaeger.SamplerTypeRateLimiting:
+		sampler = otelSamplerRateLimiting{
+			RateLimiter: utils.NewRateLimiter(config.Sampler.Param, maxFloat(config.Sampler.Param, 1)),
+			Param:       config.Sampler.Param,
+		}
+	default:
+		return nil, fmt.Errorf("opentelemetry不支持采样类型：'%s'", config.Sampler.Type)
+	}
+
+	routes := make(map[string]sdktrace.Sampler, len(config.Sampler.Routes))
+	for route, rate := range config.Sampler.Routes {
+		routes[route] = sdktrace.TraceIDRatioBased(rate)
+	}
+	return otelSampler{sampler, routes}, nil
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (t otelTracer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return t.Provider.Shutdown(ctx)
+}
+
+func (s otelSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, attr := range p.Attributes {
+		if attr.Key == attribute.Key(ext.SamplingPriority) && attr.Value.AsInt64() > 0 {
+			return sdktrace.AlwaysSample().ShouldSample(p)
+		}
+	}
+	sampler, ok := s.Routes[p.Name]
+	if ok {
+		return sampler.ShouldSample(p)
+	}
+	return s.Sampler.ShouldSample(p)
+}
+
+func (s otelSampler) Description() string {
+	return "RouteSampler{" + s.Sampler.Description() + "}"
+}
+
+func (s otelSamplerRateLimiting) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if s.CheckCredit(1.0) {
+		return sdktrace.AlwaysSample().ShouldSample(p)
+	}
+	return sdktrace.NeverSample().ShouldSample(p)
+}
+
+func (s otelSamplerRateLimiting) Description() string {
+	return fmt.Sprintf("RateLimitingSampler{%g}", s.Param)
+}
@@ -0,0 +1,109 @@
+package tracer
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpCollector 定义进程内OTLP collector，记录接收到的span名称。
+type otlpCollector struct {
+	coltracepb.UnimplementedTraceServiceServer
+	names chan string
+}
+
+func (c *otlpCollector) Export(_ context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				c.names <- span.Name
+			}
+		}
+	}
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req coltracepb.ExportTraceServiceRequest
+	body, _ := io.ReadAll(r.Body)
+	if r.URL.Path != "/v1/traces" || proto.Unmarshal(body, &req) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.Export(r.Context(), &req)
+	w.Header().Set("Content-Type", "application/x-protobuf")
+}
+
+func (c *otlpCollector) Names() map[string]bool {
+	names := make(map[string]bool)
+	for len(c.names) > 0 {
+		names[<-c.names] = true
+	}
+	return names
+}
+
+// exportSpans 函数使用配置创建exporter，发送一个parent和child span。
+func exportSpans(t *testing.T, config *Config) {
+	exporter, err := newOpentelemetryExporter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sdktrace.NewBatchSpanProcessor(exporter)))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	_, child := provider.Tracer("test").Start(ctx, "child")
+	child.End()
+	parent.End()
+	err = provider.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpentelemetryExporterHTTP(t *testing.T) {
+	collector := &otlpCollector{names: make(chan string, 16)}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	exportSpans(t, &Config{
+		ServiceName: "test",
+		Protocol:    "http",
+		Agent:       strings.TrimPrefix(srv.URL, "http://"),
+		Insecure:    true,
+	})
+	names := collector.Names()
+	if !names["parent"] || !names["child"] {
+		t.Fatalf("otlp http collector spans %v", names)
+	}
+}
+
+func TestOpentelemetryExporterGRPC(t *testing.T) {
+	collector := &otlpCollector{names: make(chan string, 16)}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(srv, collector)
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	exportSpans(t, &Config{
+		ServiceName: "test",
+		Protocol:    "grpc",
+		Agent:       ln.Addr().String(),
+		Insecure:    true,
+	})
+	names := collector.Names()
+	if !names["parent"] || !names["child"] {
+		t.Fatalf("otlp grpc collector spans %v", names)
+	}
+}
@@ -0,0 +1,407 @@
+package tracer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	otelb3 "go.opentelemetry.io/contrib/propagators/b3"
+	oteljaeger "go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// propagator 定义jaeger使用的http header传播格式。
+type propagator interface {
+	jaeger.Injector
+	jaeger.Extractor
+}
+
+// propagatorComposite 定义组合传播格式，Extract使用第一个成功的格式，Inject写入全部格式。
+type propagatorComposite []propagator
+
+// propagatorW3C 定义W3C Trace Context传播格式，使用traceparent、tracestate和baggage header。
+//
+// tracestate保存在trace共享的sampling state中，在同一trace的子span注入时原样传递。
+type propagatorW3C struct{}
+
+// propagatorTraceState 定义tracestate在jaeger sampling state中的key。
+var propagatorTraceState = &contextKey{"tracestate"}
+
+// otelJaeger 定义opentelemetry使用的jaeger传播格式，使用和jaeger后端相同的header名称，
+// baggage使用OpentracingBaggageHeaderPrefix前缀的header传递。
+type otelJaeger struct {
+	oteljaeger.Jaeger
+}
+
+// otelJaegerCarrier 定义将uber-trace-id转换为OpentracingContextHeaderName的carrier。
+type otelJaegerCarrier struct {
+	propagation.TextMapCarrier
+}
+
+// otelB3 定义opentelemetry使用的B3传播格式，没有采样标志时使用Sampler决定是否采样。
+type otelB3 struct {
+	propagation.TextMapPropagator
+	Sampler sdktrace.Sampler
+}
+
+// propagatorB3 定义B3传播格式，Single为true时使用单个b3 header。
+//
+// B3没有采样标志时由本地采样器决定，Sampler为空时不采样。
+type propagatorB3 struct {
+	Single  bool
+	Sampler jaeger.Sampler
+}
+
+// newPropagator 函数使用传播格式名称创建jaeger使用的传播格式，可选jaeger、w3c、b3、b3single。
+//
+// sampler用于决定没有采样标志的B3 trace是否采样。
+func newPropagator(names []string, sampler jaeger.Sampler) (propagator, error) {
+	headers := &jaeger.HeadersConfig{
+		TraceContextHeaderName:   OpentracingContextHeaderName,
+		TraceBaggageHeaderPrefix: OpentracingBaggageHeaderPrefix,
+		JaegerBaggageHeader:      OpentracingBaggageHeader,
+		JaegerDebugHeader:        OpentracingDebugHeader,
+	}
+	composite := make(propagatorComposite, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case "jaeger":
+			composite = append(composite, jaeger.NewHTTPHeaderPropagator(headers, *jaeger.NewNullMetrics()))
+		case "w3c":
+			composite = append(composite, propagatorW3C{})
+		case "b3":
+			composite = append(composite, propagatorB3{Sampler: sampler})
+		case "b3single":
+			composite = append(composite, propagatorB3{Single: true, Sampler: sampler})
+		default:
+			return nil, fmt.Errorf("未定义传播格式：'%s'", name)
+		}
+	}
+	if len(composite) == 1 {
+		return composite[0], nil
+	}
+	return composite, nil
+}
+
+// newOpentelemetryPropagator 函数使用传播格式名称创建opentelemetry使用的传播格式。
+//
+// opentelemetry组合格式依次Extract并覆盖结果，因此倒序组合使第一个格式优先。
+// jaeger格式使用OpentracingContextHeaderName header，和jaeger后端保持一致；
+// sampler用于决定没有采样标志的B3 trace是否采样。
+func newOpentelemetryPropagator(names []string, sampler sdktrace.Sampler) (propagation.TextMapPropagator, error) {
+	propagators := make([]propagation.TextMapPropagator, 0, len(names)+1)
+	for i := len(names) - 1; i >= 0; i-- {
+		switch names[i] {
+		case "jaeger":
+			propagators = append(propagators, otelJaeger{})
+		case "w3c":
+			propagators = append(propagators, propagation.Baggage{}, propagation.TraceContext{})
+		case "b3":
+			propagators = append(propagators, otelB3{otelb3.New(otelb3.WithInjectEncoding(otelb3.B3MultipleHeader)), sampler})
+		case "b3single":
+			propagators = append(propagators, otelB3{otelb3.New(otelb3.WithInjectEncoding(otelb3.B3SingleHeader)), sampler})
+		default:
+			return nil, fmt.Errorf("未定义传播格式：'%s'", names[i])
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
+
+func (p propagatorComposite) Inject(ctx jaeger.SpanContext, carrier interface{}) error {
+	for _, i := range p {
+		err := i.Inject(ctx, carrier)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Extract 方法返回第一个存在有效trace id的结果，
+// jaeger格式只有x-debug-id或baggage时返回的context没有trace id，仅在其他格式都不存在时使用。
+func (p propagatorComposite) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	err := opentracing.ErrSpanContextNotFound
+	var fallback *jaeger.SpanContext
+	for _, i := range p {
+		ctx, e := i.Extract(carrier)
+		switch {
+		case e == nil && ctx.TraceID().IsValid():
+			return ctx, nil
+		case e == nil && fallback == nil:
+			fallback = &ctx
+		case e != nil && e != opentracing.ErrSpanContextNotFound:
+			err = e
+		}
+	}
+	if fallback != nil {
+		return *fallback, nil
+	}
+	return jaeger.SpanContext{}, err
+}
+
+func (p otelJaeger) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	p.Jaeger.Inject(ctx, otelJaegerCarrier{carrier})
+	for _, member := range baggage.FromContext(ctx).Members() {
+		carrier.Set(OpentracingBaggageHeaderPrefix+member.Key(), url.QueryEscape(member.Value()))
+	}
+}
+
+// Extract 方法提取trace和OpentracingBaggageHeaderPrefix前缀的baggage，baggage合并到ctx已有的baggage。
+func (p otelJaeger) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	ctx = p.Jaeger.Extract(ctx, otelJaegerCarrier{carrier})
+	bag := baggage.FromContext(ctx)
+	for _, key := range carrier.Keys() {
+		name := strings.ToLower(key)
+		if !strings.HasPrefix(name, OpentracingBaggageHeaderPrefix) {
+			continue
+		}
+		val, err := url.QueryUnescape(carrier.Get(key))
+		if err != nil {
+			continue
+		}
+		member, err := baggage.NewMemberRaw(strings.TrimPrefix(name, OpentracingBaggageHeaderPrefix), val)
+		if err != nil {
+			continue
+		}
+		if b, err := bag.SetMember(member); err == nil {
+			bag = b
+		}
+	}
+	if bag.Len() == 0 {
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+func (p otelJaeger) Fields() []string {
+	return []string{OpentracingContextHeaderName}
+}
+
+// Extract 方法在B3没有采样标志时使用Sampler决定采样，opentelemetry b3默认将其视为不采样。
+func (p otelB3) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	ctx = p.TextMapPropagator.Extract(ctx, carrier)
+	sc := trace.SpanContextFromContext(ctx)
+	if p.Sampler == nil || !sc.IsValid() || sc.IsSampled() || hasB3Sampled(carrier) {
+		return ctx
+	}
+	result := p.Sampler.ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: context.Background(),
+		TraceID:       sc.TraceID(),
+	})
+	if result.Decision == sdktrace.RecordAndSample {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, sc.WithTraceFlags(sc.TraceFlags()|trace.FlagsSampled))
+	}
+	return ctx
+}
+
+// hasB3Sampled 函数判断B3 header是否存在采样标志。
+func hasB3Sampled(carrier propagation.TextMapCarrier) bool {
+	if single := carrier.Get("b3"); single != "" {
+		return len(strings.Split(single, "-")) > 2
+	}
+	return carrier.Get("X-B3-Sampled") != "" || carrier.Get("X-B3-Flags") != ""
+}
+
+func (c otelJaegerCarrier) Get(key string) string {
+	if key == "uber-trace-id" {
+		key = OpentracingContextHeaderName
+	}
+	return c.TextMapCarrier.Get(key)
+}
+
+func (c otelJaegerCarrier) Set(key, val string) {
+	if key == "uber-trace-id" {
+		key = OpentracingContextHeaderName
+	}
+	c.TextMapCarrier.Set(key, val)
+}
+
+func (propagatorW3C) Inject(ctx jaeger.SpanContext, carrier interface{}) error {
+	writer, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	flags := 0
+	if ctx.IsSampled() {
+		flags = 1
+	}
+	writer.Set("traceparent", fmt.Sprintf("00-%016x%016x-%016x-%02x", ctx.TraceID().High, ctx.TraceID().Low, uint64(ctx.SpanID()), flags))
+	state, _ := ctx.ExtendedSamplingState(propagatorTraceState, func() interface{} { return "" }).(string)
+	if state != "" {
+		writer.Set("tracestate", state)
+	}
+
+	var baggage []string
+	ctx.ForeachBaggageItem(func(k, v string) bool {
+		baggage = append(baggage, url.PathEscape(k)+"="+url.PathEscape(v))
+		return true
+	})
+	if len(baggage) > 0 {
+		writer.Set("baggage", strings.Join(baggage, ","))
+	}
+	return nil
+}
+
+func (propagatorW3C) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	reader, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return jaeger.SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	var parent, state, baggage string
+	reader.ForeachKey(func(key, val string) error {
+		switch strings.ToLower(key) {
+		case "traceparent":
+			parent = val
+		case "tracestate":
+			state = val
+		case "baggage":
+			baggage = val
+		}
+		return nil
+	})
+	// version-traceid-spanid-flags
+	parts := strings.Split(parent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 || parts[0] == "ff" {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	ctx, err := newSpanContext(parts[1], parts[2], "", flags&1 == 1, parseBaggage(baggage))
+	if err == nil && state != "" {
+		ctx.ExtendedSamplingState(propagatorTraceState, func() interface{} { return state })
+	}
+	return ctx, err
+}
+
+func (p propagatorB3) Inject(ctx jaeger.SpanContext, carrier interface{}) error {
+	writer, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+	sampled := "0"
+	if ctx.IsDebug() {
+		sampled = "d"
+	} else if ctx.IsSampled() {
+		sampled = "1"
+	}
+	traceID := fmt.Sprintf("%016x%016x", ctx.TraceID().High, ctx.TraceID().Low)
+	spanID := fmt.Sprintf("%016x", uint64(ctx.SpanID()))
+	if p.Single {
+		value := traceID + "-" + spanID + "-" + sampled
+		if ctx.ParentID() != 0 {
+			value += fmt.Sprintf("-%016x", uint64(ctx.ParentID()))
+		}
+		writer.Set("b3", value)
+		return nil
+	}
+
+	writer.Set("X-B3-TraceId", traceID)
+	writer.Set("X-B3-SpanId", spanID)
+	if ctx.ParentID() != 0 {
+		writer.Set("X-B3-ParentSpanId", fmt.Sprintf("%016x", uint64(ctx.ParentID())))
+	}
+	if sampled == "d" {
+		writer.Set("X-B3-Flags", "1")
+	} else {
+		writer.Set("X-B3-Sampled", sampled)
+	}
+	return nil
+}
+
+func (p propagatorB3) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	reader, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return jaeger.SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+	var single, traceID, spanID, parentID, sampled, flags string
+	reader.ForeachKey(func(key, val string) error {
+		switch strings.ToLower(key) {
+		case "b3":
+			single = val
+		case "x-b3-traceid":
+			traceID = val
+		case "x-b3-spanid":
+			spanID = val
+		case "x-b3-parentspanid":
+			parentID = val
+		case "x-b3-sampled":
+			sampled = val
+		case "x-b3-flags":
+			flags = val
+		}
+		return nil
+	})
+	if single != "" {
+		// traceid-spanid-sampled-parentspanid
+		parts := strings.Split(single, "-")
+		if len(parts) < 2 {
+			return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+		}
+		traceID, spanID = parts[0], parts[1]
+		if len(parts) > 2 {
+			sampled = parts[2]
+		}
+		if len(parts) > 3 {
+			parentID = parts[3]
+		}
+	}
+	if traceID == "" || spanID == "" {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	ctx, err := newSpanContext(traceID, spanID, parentID, sampled == "1" || sampled == "true" || sampled == "d" || flags == "1", nil)
+	if err == nil && sampled == "" && flags == "" && p.Sampler != nil {
+		// 没有采样标志时由本地采样器决定，jaeger不会再次采样提取的context。
+		ok, _ := p.Sampler.IsSampled(ctx.TraceID(), "")
+		ctx = jaeger.NewSpanContext(ctx.TraceID(), ctx.SpanID(), ctx.ParentID(), ok, nil)
+	}
+	return ctx, err
+}
+
+func newSpanContext(traceID, spanID, parentID string, sampled bool, baggage map[string]string) (jaeger.SpanContext, error) {
+	trace, err := jaeger.TraceIDFromString(traceID)
+	if err != nil {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	span, err := jaeger.SpanIDFromString(spanID)
+	if err != nil || !trace.IsValid() || span == 0 {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+	}
+	var parent jaeger.SpanID
+	if parentID != "" {
+		parent, err = jaeger.SpanIDFromString(parentID)
+		if err != nil {
+			return jaeger.SpanContext{}, opentracing.ErrSpanContextCorrupted
+		}
+	}
+	return jaeger.NewSpanContext(trace, span, parent, sampled, baggage), nil
+}
+
+// parseBaggage 函数解析W3C baggage header，忽略属性。
+func parseBaggage(state string) map[string]string {
+	if state == "" {
+		return nil
+	}
+	baggage := make(map[string]string)
+	for _, member := range strings.Split(state, ",") {
+		member = strings.TrimSpace(strings.SplitN(member, ";", 2)[0])
+		pos := strings.IndexByte(member, '=')
+		if pos == -1 {
+			continue
+		}
+		key, err1 := url.PathUnescape(strings.TrimSpace(member[:pos]))
+		val, err2 := url.PathUnescape(strings.TrimSpace(member[pos+1:]))
+		if err1 == nil && err2 == nil {
+			baggage[key] = val
+		}
+	}
+	return baggage
+}
@@ -0,0 +1,231 @@
+package tracer
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestSpanContext(sampled bool) jaeger.SpanContext {
+	return jaeger.NewSpanContext(
+		jaeger.TraceID{High: 0x0102030405060708, Low: 0x090a0b0c0d0e0f10},
+		jaeger.SpanID(0x1112131415161718), 0, sampled,
+		map[string]string{"tenant": "t1"},
+	)
+}
+
+func getBaggageItem(ctx jaeger.SpanContext, key string) (val string) {
+	ctx.ForeachBaggageItem(func(k, v string) bool {
+		if k == key {
+			val = v
+		}
+		return true
+	})
+	return
+}
+
+func TestPropagatorRoundTrip(t *testing.T) {
+	for _, names := range [][]string{{"jaeger"}, {"w3c"}, {"b3"}, {"b3single"}, {"w3c", "b3", "jaeger"}} {
+		for _, sampled := range []bool{true, false} {
+			p, err := newPropagator(names, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header := http.Header{}
+			want := newTestSpanContext(sampled)
+			if err = p.Inject(want, opentracing.HTTPHeadersCarrier(header)); err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Extract(opentracing.HTTPHeadersCarrier(header))
+			if err != nil {
+				t.Fatalf("%v extract %v: %v", names, header, err)
+			}
+			if got.TraceID() != want.TraceID() || got.SpanID() != want.SpanID() || got.IsSampled() != sampled {
+				t.Errorf("%v extract %s want %s", names, got, want)
+			}
+			if names[0] != "b3" && names[0] != "b3single" && getBaggageItem(got, "tenant") != "t1" {
+				t.Errorf("%v extract baggage %v", names, header)
+			}
+		}
+	}
+}
+
+func TestPropagatorExtractHeader(t *testing.T) {
+	traceID := "0af7651916cd43dd8448eb211c80319c"
+	tests := []struct {
+		names  []string
+		header map[string]string
+		trace  string
+		err    error
+	}{
+		{[]string{"w3c"}, map[string]string{"traceparent": "00-" + traceID + "-b7ad6b7169203331-01"}, traceID, nil},
+		{[]string{"w3c"}, map[string]string{"traceparent": "ff-" + traceID + "-b7ad6b7169203331-01"}, "", opentracing.ErrSpanContextNotFound},
+		{[]string{"b3"}, map[string]string{"X-B3-TraceId": traceID, "X-B3-SpanId": "b7ad6b7169203331", "X-B3-Sampled": "1"}, traceID, nil},
+		{[]string{"b3single"}, map[string]string{"b3": traceID + "-b7ad6b7169203331-1"}, traceID, nil},
+		{[]string{"jaeger"}, map[string]string{OpentracingContextHeaderName: traceID + ":b7ad6b7169203331:0:1"}, traceID, nil},
+		// jaeger只有debug和baggage header时不能覆盖有效的traceparent。
+		{[]string{"jaeger", "w3c"}, map[string]string{
+			OpentracingDebugHeader:                    "debug",
+			OpentracingBaggageHeaderPrefix + "tenant": "t1",
+			"traceparent":                             "00-" + traceID + "-b7ad6b7169203331-01",
+		}, traceID, nil},
+		{[]string{"w3c", "b3"}, map[string]string{"b3": traceID + "-b7ad6b7169203331-1"}, traceID, nil},
+		{[]string{"w3c", "b3"}, map[string]string{}, "", opentracing.ErrSpanContextNotFound},
+	}
+	for i, test := range tests {
+		p, err := newPropagator(test.names, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := http.Header{}
+		for k, v := range test.header {
+			header.Set(k, v)
+		}
+		ctx, err := p.Extract(opentracing.HTTPHeadersCarrier(header))
+		if err != test.err {
+			t.Errorf("%d extract error %v want %v", i, err, test.err)
+			continue
+		}
+		if err == nil && ctx.TraceID().String() != test.trace {
+			t.Errorf("%d extract trace %s want %s", i, ctx.TraceID(), test.trace)
+		}
+	}
+}
+
+func TestPropagatorTraceState(t *testing.T) {
+	p, _ := newPropagator([]string{"w3c"}, nil)
+	header := http.Header{}
+	header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	header.Set("tracestate", "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7")
+	ctx, err := p.Extract(opentracing.HTTPHeadersCarrier(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter(),
+		jaeger.TracerOptions.Injector(opentracing.HTTPHeaders, p),
+		jaeger.TracerOptions.Extractor(opentracing.HTTPHeaders, p),
+	)
+	defer closer.Close()
+	span := tracer.StartSpan("server", opentracing.ChildOf(ctx))
+	child := tracer.StartSpan("client", opentracing.ChildOf(span.Context()))
+	out := http.Header{}
+	tracer.Inject(child.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(out))
+	if out.Get("tracestate") != header.Get("tracestate") {
+		t.Errorf("tracestate %q want %q", out.Get("tracestate"), header.Get("tracestate"))
+	}
+}
+
+// TestPropagatorOpentelemetry 测试jaeger后端和opentelemetry后端使用相同传播格式名称时可以互通。
+func TestPropagatorOpentelemetry(t *testing.T) {
+	for _, names := range [][]string{{"jaeger"}, {"w3c"}, {"b3"}, {"b3single"}} {
+		p, _ := newPropagator(names, nil)
+		otelp, err := newOpentelemetryPropagator(names, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// jaeger后端注入，opentelemetry后端提取。
+		want := newTestSpanContext(true)
+		header := http.Header{}
+		p.Inject(want, opentracing.HTTPHeadersCarrier(header))
+		sc := trace.SpanContextFromContext(otelp.Extract(context.Background(), propagation.HeaderCarrier(header)))
+		if sc.TraceID().String() != want.TraceID().String() || sc.SpanID().String() != want.SpanID().String() || !sc.IsSampled() {
+			t.Errorf("%v opentelemetry extract %v from %v", names, sc, header)
+		}
+
+		// opentelemetry后端注入，jaeger后端提取。
+		header = http.Header{}
+		otelp.Inject(trace.ContextWithRemoteSpanContext(context.Background(), sc), propagation.HeaderCarrier(header))
+		got, err := p.Extract(opentracing.HTTPHeadersCarrier(header))
+		if err != nil || got.TraceID() != want.TraceID() || got.SpanID() != want.SpanID() {
+			t.Errorf("%v jaeger extract %v from %v: %v", names, got, header, err)
+		}
+	}
+}
+
+// TestPropagatorB3Sampler 测试B3没有采样标志时jaeger和opentelemetry后端都使用本地采样器决定。
+func TestPropagatorB3Sampler(t *testing.T) {
+	traceID, spanID := "0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"
+	tests := []struct {
+		names   []string
+		header  map[string]string
+		sampler bool
+		sampled bool
+	}{
+		{[]string{"b3"}, map[string]string{"X-B3-TraceId": traceID, "X-B3-SpanId": spanID}, true, true},
+		{[]string{"b3"}, map[string]string{"X-B3-TraceId": traceID, "X-B3-SpanId": spanID}, false, false},
+		{[]string{"b3"}, map[string]string{"X-B3-TraceId": traceID, "X-B3-SpanId": spanID, "X-B3-Sampled": "0"}, true, false},
+		{[]string{"b3"}, map[string]string{"X-B3-TraceId": traceID, "X-B3-SpanId": spanID, "X-B3-Sampled": "1"}, false, true},
+		{[]string{"b3single"}, map[string]string{"b3": traceID + "-" + spanID}, true, true},
+		{[]string{"b3single"}, map[string]string{"b3": traceID + "-" + spanID}, false, false},
+		{[]string{"b3single"}, map[string]string{"b3": traceID + "-" + spanID + "-0"}, true, false},
+		{[]string{"w3c", "b3"}, map[string]string{"X-B3-TraceId": traceID, "X-B3-SpanId": spanID}, true, true},
+	}
+	for i, test := range tests {
+		header := http.Header{}
+		for k, v := range test.header {
+			header.Set(k, v)
+		}
+
+		p, _ := newPropagator(test.names, jaeger.NewConstSampler(test.sampler))
+		ctx, err := p.Extract(opentracing.HTTPHeadersCarrier(header))
+		if err != nil || ctx.TraceID().String() != traceID || ctx.IsSampled() != test.sampled {
+			t.Errorf("%d jaeger extract %s sampled %t: %v", i, ctx, test.sampled, err)
+		}
+
+		sampler := sdktrace.NeverSample()
+		if test.sampler {
+			sampler = sdktrace.AlwaysSample()
+		}
+		otelp, _ := newOpentelemetryPropagator(test.names, sampler)
+		sc := trace.SpanContextFromContext(otelp.Extract(context.Background(), propagation.HeaderCarrier(header)))
+		if sc.TraceID().String() != traceID || sc.IsSampled() != test.sampled {
+			t.Errorf("%d opentelemetry extract %v sampled %t", i, sc, test.sampled)
+		}
+	}
+}
+
+// TestPropagatorOpentelemetryBaggage 测试jaeger格式的baggage在jaeger和opentelemetry后端之间互通。
+func TestPropagatorOpentelemetryBaggage(t *testing.T) {
+	p, _ := newPropagator([]string{"jaeger"}, nil)
+	otelp, _ := newOpentelemetryPropagator([]string{"jaeger"}, nil)
+	value := "t1 a,b=c"
+
+	// opentelemetry后端注入，jaeger后端提取。
+	member, _ := baggage.NewMemberRaw("tenant", value)
+	bag, _ := baggage.New(member)
+	header := http.Header{}
+	p.Inject(newTestSpanContext(true), opentracing.HTTPHeadersCarrier(header))
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.SpanContextFromContext(
+		otelp.Extract(context.Background(), propagation.HeaderCarrier(header)),
+	))
+	header = http.Header{}
+	otelp.Inject(baggage.ContextWithBaggage(ctx, bag), propagation.HeaderCarrier(header))
+	if header.Get(OpentracingBaggageHeaderPrefix+"tenant") == "" {
+		t.Errorf("opentelemetry inject baggage %v", header)
+	}
+	got, err := p.Extract(opentracing.HTTPHeadersCarrier(header))
+	if err != nil || got.TraceID() != newTestSpanContext(true).TraceID() || getBaggageItem(got, "tenant") != value {
+		t.Errorf("jaeger extract baggage %v from %v: %v", got, header, err)
+	}
+
+	// jaeger后端注入，opentelemetry后端提取。
+	header = http.Header{}
+	want := jaeger.NewSpanContext(got.TraceID(), got.SpanID(), 0, true, map[string]string{"tenant": value})
+	p.Inject(want, opentracing.HTTPHeadersCarrier(header))
+	ctx = otelp.Extract(context.Background(), propagation.HeaderCarrier(header))
+	if val := baggage.FromContext(ctx).Member("tenant").Value(); val != value {
+		t.Errorf("opentelemetry extract baggage %q from %v", val, header)
+	}
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		t.Errorf("opentelemetry extract trace from %v", header)
+	}
+}
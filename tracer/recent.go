@@ -0,0 +1,317 @@
+package tracer
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eudore/eudore"
+	"github.com/uber/jaeger-client-go"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// RecentMaxSpans 定义每个最近trace保存的最大span数量。
+var RecentMaxSpans = 1000
+
+// RecentTraces 定义保存最近trace的环形缓冲区，超过Size后淘汰最早的trace。
+type RecentTraces struct {
+	sync.RWMutex
+	Size   int
+	traces map[string]*recentTrace
+	order  []string
+	pos    int
+}
+
+// RecentTrace 定义最近trace的摘要和span瀑布图数据。
+type RecentTrace struct {
+	TraceID   string       `json:"traceID"`
+	Operation string       `json:"operation"`
+	Method    string       `json:"method"`
+	Route     string       `json:"route"`
+	Status    int          `json:"status"`
+	Error     bool         `json:"error"`
+	StartTime int64        `json:"startTime"`
+	Duration  int64        `json:"duration"`
+	SpanCount int          `json:"spanCount"`
+	Spans     []RecentSpan `json:"spans,omitempty"`
+}
+
+// RecentSpan 定义瀑布图中的span，Depth为层级，Offset为相对trace开始的微秒偏移。
+type RecentSpan struct {
+	*SpanData
+	Depth  int   `json:"depth"`
+	Offset int64 `json:"offset"`
+}
+
+// RecentFilter 定义最近trace的过滤条件，Status可以使用5xx格式匹配状态码前缀。
+type RecentFilter struct {
+	Route    string
+	Status   string
+	Duration time.Duration
+	Limit    int
+}
+
+type recentTrace struct {
+	RecentTrace
+	spans []*SpanData
+}
+
+type recentReporter struct {
+	*RecentTraces
+	ServiceName string
+}
+
+type recentProcessor struct {
+	*RecentTraces
+}
+
+// NewRecentTraces 函数创建保存size个最近trace的缓冲区，size小于等于0时使用100。
+func NewRecentTraces(size int) *RecentTraces {
+	if size <= 0 {
+		size = 100
+	}
+	return &RecentTraces{
+		Size:   size,
+		traces: make(map[string]*recentTrace, size),
+		order:  make([]string, size),
+	}
+}
+
+// Add 方法添加一个完成的span，请求的根span完成时更新trace摘要。
+func (r *RecentTraces) Add(span *SpanData) {
+	r.Lock()
+	defer r.Unlock()
+	trace, ok := r.traces[span.TraceID]
+	if !ok {
+		if r.order[r.pos] != "" {
+			delete(r.traces, r.order[r.pos])
+		}
+		trace = &recentTrace{RecentTrace: RecentTrace{TraceID: span.TraceID}}
+		r.traces[span.TraceID] = trace
+		r.order[r.pos] = span.TraceID
+		r.pos = (r.pos + 1) % len(r.order)
+	}
+	if len(trace.spans) < RecentMaxSpans {
+		trace.spans = append(trace.spans, span)
+	}
+	trace.SpanCount++
+	if span.GetTag("error") == true {
+		trace.Error = true
+	}
+
+	// 本服务的入口span作为trace摘要。
+	if trace.Operation == "" && (span.GetParentID() == "" || span.GetTag("span.kind") == "server") {
+		trace.Operation = span.OperationName
+		trace.Method, _ = span.GetTag("http.method").(string)
+		trace.Route, _ = span.GetTag("http.route").(string)
+		trace.Status = getSpanTagInt(span.GetTag("http.status"))
+		trace.StartTime = span.StartTime
+		trace.Duration = span.Duration
+	}
+}
+
+// List 方法返回过滤后的trace摘要，最新的trace在前。
+func (r *RecentTraces) List(filter RecentFilter) []RecentTrace {
+	r.RLock()
+	defer r.RUnlock()
+	status := strings.TrimRight(strings.ToLower(filter.Status), "x")
+	traces := make([]RecentTrace, 0, len(r.traces))
+	size := len(r.order)
+	for i := 1; i <= size; i++ {
+		trace, ok := r.traces[r.order[(r.pos-i+size)%size]]
+		if !ok || trace.Operation == "" {
+			continue
+		}
+		if (filter.Route != "" && trace.Route != filter.Route) ||
+			(status != "" && !strings.HasPrefix(strconv.Itoa(trace.Status), status)) ||
+			(trace.Duration < int64(filter.Duration/time.Microsecond)) {
+			continue
+		}
+		traces = append(traces, trace.RecentTrace)
+		if len(traces) == filter.Limit {
+			break
+		}
+	}
+	return traces
+}
+
+// Get 方法返回trace和按照调用层级排序的span瀑布图，trace不存在返回nil。
+func (r *RecentTraces) Get(id string) *RecentTrace {
+	r.RLock()
+	trace, ok := r.traces[id]
+	if !ok {
+		r.RUnlock()
+		return nil
+	}
+	data := trace.RecentTrace
+	spans := append([]*SpanData{}, trace.spans...)
+	r.RUnlock()
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].StartTime < spans[j].StartTime
+	})
+	ids := make(map[string]bool, len(spans))
+	childs := make(map[string][]*SpanData, len(spans))
+	for _, span := range spans {
+		ids[span.SpanID] = true
+	}
+	var roots []*SpanData
+	for _, span := range spans {
+		parent := span.GetParentID()
+		if ids[parent] {
+			childs[parent] = append(childs[parent], span)
+		} else {
+			roots = append(roots, span)
+		}
+	}
+	if len(roots) > 0 && (data.StartTime == 0 || roots[0].StartTime < data.StartTime) {
+		data.StartTime = roots[0].StartTime
+	}
+
+	var walk func([]*SpanData, int)
+	walk = func(spans []*SpanData, depth int) {
+		for _, span := range spans {
+			data.Spans = append(data.Spans, RecentSpan{span, depth, span.StartTime - data.StartTime})
+			if end := span.StartTime + span.Duration - data.StartTime; end > data.Duration {
+				data.Duration = end
+			}
+			walk(childs[span.SpanID], depth+1)
+		}
+	}
+	walk(roots, 0)
+	return &data
+}
+
+func (r recentReporter) Report(span *jaeger.Span) {
+	r.Add(newSpanDataJaeger(span, r.ServiceName))
+}
+
+func (r recentReporter) Close() {}
+
+func (r recentProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (r recentProcessor) OnEnd(span sdktrace.ReadOnlySpan) {
+	r.Add(newSpanDataOpentelemetry(span))
+}
+
+func (r recentProcessor) Shutdown(context.Context) error {
+	return nil
+}
+
+func (r recentProcessor) ForceFlush(context.Context) error {
+	return nil
+}
+
+func getSpanTagInt(val interface{}) int {
+	switch v := val.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case uint16:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// NewRecentHandler 函数创建最近trace查看处理函数，处理逻辑见RecentTraces.ServeHTTP。
+//
+// span包含sql语句、客户端ip等敏感数据，需要挂载到管理端口或者在鉴权中间件之后。
+func NewRecentHandler(traces *RecentTraces) eudore.HandlerFunc {
+	return func(ctx eudore.Context) {
+		traces.ServeHTTP(ctx.Response(), ctx.Request())
+	}
+}
+
+// ServeHTTP 方法实现http.Handler接口，查看最近trace。
+//
+// 参数trace指定trace id返回span瀑布图，否则返回使用route、status、duration、limit过滤的trace列表；
+// 请求Accept为text/html或参数format=html时返回html页面，否则返回json。
+func (traces *RecentTraces) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if traces == nil {
+		http.Error(w, "recent traces is disabled", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	html := query.Get("format") == "html" ||
+		(query.Get("format") == "" && strings.Contains(r.Header.Get(eudore.HeaderAccept), eudore.MimeTextHTML))
+
+	var data interface{}
+	tmpl := recentListTemplate
+	if id := query.Get("trace"); id != "" {
+		trace := traces.Get(id)
+		if trace == nil {
+			http.Error(w, "trace not found", http.StatusNotFound)
+			return
+		}
+		data, tmpl = trace, recentTraceTemplate
+	} else {
+		duration, _ := time.ParseDuration(query.Get("duration"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		data = traces.List(RecentFilter{
+			Route:    query.Get("route"),
+			Status:   query.Get("status"),
+			Duration: duration,
+			Limit:    limit,
+		})
+	}
+
+	if html {
+		w.Header().Set(eudore.HeaderContentType, eudore.MimeTextHTMLCharsetUtf8)
+		err := tmpl.Execute(w, data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set(eudore.HeaderContentType, "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(data)
+}
+
+var recentTemplateFuncs = template.FuncMap{
+	"iserror": func(span RecentSpan) bool {
+		return span.GetTag("error") == true
+	},
+	"ms": func(us int64) string {
+		return strconv.FormatFloat(float64(us)/1e3, 'f', 3, 64) + "ms"
+	},
+	"percent": func(val, total int64) string {
+		if total <= 0 {
+			return "0"
+		}
+		return strconv.FormatFloat(float64(val)*100/float64(total), 'f', 2, 64)
+	},
+	"time": func(us int64) string {
+		return time.UnixMicro(us).Format("2006-01-02 15:04:05.000")
+	},
+}
+
+var recentListTemplate = template.Must(template.New("list").Funcs(recentTemplateFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Recent Traces</title>
+<style>body{font-family:monospace}td,th{padding:2px 8px;text-align:left}.error{color:#c00}</style></head>
+<body><form><input name="route" placeholder="route"> <input name="status" placeholder="status 5xx"> <input name="duration" placeholder="duration 100ms">
+<input type="hidden" name="format" value="html"> <button>filter</button></form>
+<table><tr><th>time</th><th>trace</th><th>method</th><th>route</th><th>status</th><th>duration</th><th>spans</th></tr>
+{{range .}}<tr{{if .Error}} class="error"{{end}}><td>{{time .StartTime}}</td><td><a href="?format=html&trace={{.TraceID}}">{{.TraceID}}</a></td><td>{{.Method}}</td><td>{{.Route}}</td><td>{{.Status}}</td><td>{{ms .Duration}}</td><td>{{.SpanCount}}</td></tr>
+{{end}}</table></body></html>`))
+
+var recentTraceTemplate = template.Must(template.New("trace").Funcs(recentTemplateFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Trace {{.TraceID}}</title>
+<style>body{font-family:monospace}.span{position:relative;height:20px;margin:2px 0;background:#eee}
+.bar{position:absolute;height:20px;background:#7ab;min-width:1px}.error .bar{background:#d66}
+.name{position:absolute;left:4px;white-space:nowrap}details{margin-left:16px}</style></head>
+<body><p><a href="?format=html">recent traces</a> {{.TraceID}} {{.Method}} {{.Route}} {{.Status}} {{ms .Duration}}</p>
+{{$total := .Duration}}{{range .Spans}}<div class="span{{if iserror .}} error{{end}}">
+<div class="bar" style="left:{{percent .Offset $total}}%;width:{{percent .Duration $total}}%"></div>
+<div class="name" style="padding-left:{{.Depth}}em">{{.OperationName}} {{ms .Duration}}</div></div>
+<details><summary>tags and logs</summary><ul>{{range .Tags}}<li>{{.Key}}={{.Value}}</li>{{end}}</ul>
+{{range .Logs}}<ul>{{time .Timestamp}}{{range .Fields}}<li>{{.Key}}={{.Value}}</li>{{end}}</ul>{{end}}</details>
+{{end}}</body></html>`))
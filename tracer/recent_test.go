@@ -0,0 +1,158 @@
+package tracer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRecentSpan(trace, span, parent, route string, status int, start, duration int64, tags ...SpanKeyValue) *SpanData {
+	data := &SpanData{
+		TraceID:       trace,
+		SpanID:        span,
+		OperationName: span,
+		StartTime:     start,
+		Duration:      duration,
+		Tags:          tags,
+	}
+	if parent != "" {
+		data.References = []SpanReference{{"CHILD_OF", trace, parent}}
+	}
+	if route != "" {
+		data.Tags = append(data.Tags,
+			newSpanKeyValue("span.kind", "server"),
+			newSpanKeyValue("http.method", http.MethodGet),
+			newSpanKeyValue("http.route", route),
+			newSpanKeyValue("http.status", status),
+		)
+	}
+	return data
+}
+
+func newTestRecentTraces(size int) *RecentTraces {
+	traces := NewRecentTraces(size)
+	traces.Add(newRecentSpan("t1", "t1-server", "", "/users/:id", 200, 1000, 10000))
+	traces.Add(newRecentSpan("t2", "t2-db", "t2-server", "", 0, 2100, 300000, newSpanKeyValue("error", true)))
+	traces.Add(newRecentSpan("t2", "t2-server", "", "/users/:id", 503, 2000, 500000))
+	traces.Add(newRecentSpan("t3", "t3-server", "", "/orders", 404, 3000, 20000))
+	return traces
+}
+
+func getRecentIDs(traces []RecentTrace) string {
+	ids := make([]string, len(traces))
+	for i := range traces {
+		ids[i] = traces[i].TraceID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestRecentTracesList(t *testing.T) {
+	traces := newTestRecentTraces(10)
+	for _, expect := range []struct {
+		filter RecentFilter
+		ids    string
+	}{
+		{RecentFilter{}, "t3,t2,t1"},
+		{RecentFilter{Route: "/users/:id"}, "t2,t1"},
+		{RecentFilter{Status: "5xx"}, "t2"},
+		{RecentFilter{Status: "4XX"}, "t3"},
+		{RecentFilter{Status: "200"}, "t1"},
+		{RecentFilter{Duration: 15 * time.Millisecond}, "t3,t2"},
+		{RecentFilter{Route: "/users/:id", Duration: 100 * time.Millisecond}, "t2"},
+		{RecentFilter{Limit: 2}, "t3,t2"},
+	} {
+		got := getRecentIDs(traces.List(expect.filter))
+		if got != expect.ids {
+			t.Errorf("recent list %+v got %s, want %s", expect.filter, got, expect.ids)
+		}
+	}
+
+	list := traces.List(RecentFilter{Status: "5xx"})
+	if !list[0].Error || list[0].SpanCount != 2 || list[0].Method != http.MethodGet {
+		t.Errorf("recent summary %+v", list[0])
+	}
+}
+
+func TestRecentTracesSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		traces := NewRecentTraces(size)
+		traces.Add(newRecentSpan("t1", "t1-server", "", "/", 200, 1000, 1000))
+		if len(traces.List(RecentFilter{})) != 1 {
+			t.Errorf("recent traces size %d not use default", size)
+		}
+	}
+
+	traces := newTestRecentTraces(2)
+	if got := getRecentIDs(traces.List(RecentFilter{})); got != "t3,t2" {
+		t.Errorf("recent traces evict got %s", got)
+	}
+	if traces.Get("t1") != nil {
+		t.Error("recent traces evicted trace found")
+	}
+}
+
+func TestRecentTracesGet(t *testing.T) {
+	traces := newTestRecentTraces(10)
+	trace := traces.Get("t2")
+	if trace == nil || len(trace.Spans) != 2 {
+		t.Fatalf("recent get %+v", trace)
+	}
+	server, db := trace.Spans[0], trace.Spans[1]
+	if server.SpanID != "t2-server" || server.Depth != 0 || server.Offset != 0 {
+		t.Errorf("recent server span %s depth %d offset %d", server.SpanID, server.Depth, server.Offset)
+	}
+	if db.SpanID != "t2-db" || db.Depth != 1 || db.Offset != 100 {
+		t.Errorf("recent db span %s depth %d offset %d", db.SpanID, db.Depth, db.Offset)
+	}
+	if trace.Duration != 500000 {
+		t.Errorf("recent trace duration %d", trace.Duration)
+	}
+}
+
+func TestRecentTracesHTTP(t *testing.T) {
+	traces := newTestRecentTraces(10)
+	w := httptest.NewRecorder()
+	traces.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/traces?status=5xx", nil))
+	var list []RecentTrace
+	err := json.Unmarshal(w.Body.Bytes(), &list)
+	if err != nil || getRecentIDs(list) != "t2" {
+		t.Errorf("recent json list %s %v", w.Body.String(), err)
+	}
+
+	w = httptest.NewRecorder()
+	traces.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/traces?format=html&route=/orders", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, `href="?format=html&trace=t3"`) || strings.Contains(body, "trace=t2") {
+		t.Errorf("recent html list %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/debug/traces?trace=t2", nil)
+	req.Header.Set("Accept", "text/html")
+	traces.ServeHTTP(w, req)
+	body = w.Body.String()
+	for _, s := range []string{
+		`<div class="span error">`,
+		`left:0.00%;width:100.00%`,
+		`left:0.02%;width:60.00%`,
+		`padding-left:1em">t2-db 300.000ms`,
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("recent html trace not has %s: %s", s, body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	traces.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/traces?trace=none", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("recent unknown trace status %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	(*RecentTraces)(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/traces", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("recent disabled status %d", w.Code)
+	}
+}
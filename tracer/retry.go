@@ -0,0 +1,254 @@
+package tracer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// ContextItemHTTPAttempt 定义http客户端请求重试次数的context key，第一次请求为1。
+var ContextItemHTTPAttempt = &contextKey{"http-attempt"}
+
+// RetryConfig 定义http客户端重试配置。
+//
+// 只重试幂等方法或者带有IdempotencyHeader的请求，请求body需要可以使用GetBody重新读取；
+// 临时网络错误和Statuses状态码会重试，在MinBackoff和MaxBackoff之间指数退避并添加随机抖动，
+// 响应存在Retry-After时等待指定时间，超过MaxRetryAfter不再重试。
+//
+// Budget定义重试预算，每个请求增加Budget个令牌，每次重试消耗1个令牌，最多保存BudgetBurst个令牌，
+// 防止下游故障时重试放大请求。MaxRetries小于0时关闭重试。
+type RetryConfig struct {
+	MaxRetries        int           `json:"maxretries" alias:"maxretries"`
+	MinBackoff        time.Duration `json:"minbackoff" alias:"minbackoff"`
+	MaxBackoff        time.Duration `json:"maxbackoff" alias:"maxbackoff"`
+	MaxRetryAfter     time.Duration `json:"maxretryafter" alias:"maxretryafter"`
+	Statuses          []int         `json:"statuses" alias:"statuses"`
+	IdempotencyHeader string        `json:"idempotencyheader" alias:"idempotencyheader"`
+	Budget            float64       `json:"budget" alias:"budget"`
+	BudgetBurst       float64       `json:"budgetburst" alias:"budgetburst"`
+}
+
+type httpRetry struct {
+	*RetryConfig
+	next   http.RoundTripper
+	budget *retryBudget
+}
+
+// retryBudget 定义重试令牌桶。
+type retryBudget struct {
+	sync.Mutex
+	tokens float64
+	ratio  float64
+	burst  float64
+}
+
+// NewRetryHTTPClient 函数复制http.Client并设置Transport支持失败重试，不修改原client，
+// 需要在NewOpentracingHTTPClient之后设置，每次请求创建一个带有http.attempt的子span。
+func NewRetryHTTPClient(client *http.Client, config *RetryConfig) *http.Client {
+	if config.MaxRetries < 0 {
+		return client
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 2
+	}
+	if config.MinBackoff == 0 {
+		config.MinBackoff = 100 * time.Millisecond
+	}
+	if config.MaxBackoff == 0 {
+		config.MaxBackoff = 5 * time.Second
+	}
+	if config.MaxRetryAfter == 0 {
+		config.MaxRetryAfter = 30 * time.Second
+	}
+	if len(config.Statuses) == 0 {
+		config.Statuses = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	if config.IdempotencyHeader == "" {
+		config.IdempotencyHeader = "Idempotency-Key"
+	}
+	if config.Budget == 0 {
+		config.Budget = 0.2
+	}
+	if config.BudgetBurst == 0 {
+		config.BudgetBurst = 10
+	}
+	c := *client
+	if c.Transport == nil {
+		c.Transport = http.DefaultTransport
+	}
+	c.Transport = httpRetry{
+		RetryConfig: config,
+		next:        c.Transport,
+		budget:      &retryBudget{tokens: config.BudgetBurst, ratio: config.Budget, burst: config.BudgetBurst},
+	}
+	return &c
+}
+
+func (retry httpRetry) RoundTripper() http.RoundTripper {
+	return retry.next
+}
+
+func (retry httpRetry) RoundTrip(req *http.Request) (*http.Response, error) {
+	retry.budget.Deposit()
+	ctx := req.Context()
+	canRetry := retry.isIdempotent(req)
+	backoff := retry.MinBackoff
+	for attempt := 1; ; attempt++ {
+		r := req.WithContext(context.WithValue(ctx, ContextItemHTTPAttempt, attempt))
+		if attempt > 1 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+
+		resp, err := retry.next.RoundTrip(r)
+		if !canRetry || attempt > retry.MaxRetries || ctx.Err() != nil || !retry.isRetryable(resp, err) {
+			return resp, err
+		}
+		wait := jitter(backoff)
+		if resp != nil {
+			after, ok := parseRetryAfter(resp.Header.Get("Retry-After"))
+			if ok && after > retry.MaxRetryAfter {
+				return resp, err
+			}
+			if ok && after > wait {
+				wait = after
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+		if !retry.budget.Withdraw() {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		retryLog(ctx, attempt, wait, resp, err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > retry.MaxBackoff {
+			backoff = retry.MaxBackoff
+		}
+	}
+}
+
+// isIdempotent 方法检查请求是否可以重复发送。
+func (retry httpRetry) isIdempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(retry.IdempotencyHeader) != ""
+}
+
+func (retry httpRetry) isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return isRetryableError(err)
+	}
+	for _, status := range retry.Statuses {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableError 函数检查错误是否为临时网络错误：连接被拒绝或重置、响应前连接关闭和超时，
+// 协议、证书和代理等错误重试也不会成功。
+func isRetryableError(err error) bool {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.As(err, &netErr):
+		return netErr.Timeout()
+	}
+	return false
+}
+
+// Deposit 方法在每个请求时增加重试令牌。
+func (budget *retryBudget) Deposit() {
+	budget.Lock()
+	budget.tokens += budget.ratio
+	if budget.tokens > budget.burst {
+		budget.tokens = budget.burst
+	}
+	budget.Unlock()
+}
+
+// Withdraw 方法消耗一个重试令牌，令牌不足返回false。
+func (budget *retryBudget) Withdraw() bool {
+	budget.Lock()
+	defer budget.Unlock()
+	if budget.tokens < 1 {
+		return false
+	}
+	budget.tokens--
+	return true
+}
+
+// jitter 函数返回[d/2, d)之间的随机时间。
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// parseRetryAfter 函数解析Retry-After的秒数或http时间。
+func parseRetryAfter(val string) (time.Duration, bool) {
+	if val == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(val); err == nil && sec >= 0 {
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(val); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// retryLog 函数在父span记录重试原因。
+func retryLog(ctx context.Context, attempt int, wait time.Duration, resp *http.Response, err error) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	fields := []log.Field{log.String("event", "retry"), log.Int("attempt", attempt), log.String("wait", wait.String())}
+	if err != nil {
+		fields = append(fields, log.String("error", err.Error()))
+	} else {
+		fields = append(fields, log.Int("http.status", resp.StatusCode))
+	}
+	span.LogFields(fields...)
+}
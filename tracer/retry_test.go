@@ -0,0 +1,181 @@
+package tracer
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// newRetryServer 函数创建前fails次请求返回503的服务，返回请求次数。
+func newRetryServer(fails int32) (*httptest.Server, *int32) {
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) <= fails {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	return srv, &count
+}
+
+func TestRetryHTTPClientGet(t *testing.T) {
+	srv, count := newRetryServer(2)
+	defer srv.Close()
+
+	tracer := NewMockTracer()
+	parent := tracer.StartSpan("parent")
+	req, _ := http.NewRequestWithContext(opentracing.ContextWithSpan(context.Background(), parent), http.MethodGet, srv.URL, nil)
+	client := NewRetryHTTPClient(NewOpentracingHTTPClient(&http.Client{}), &RetryConfig{MinBackoff: time.Millisecond})
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.Finish()
+	if resp.StatusCode != http.StatusOK || atomic.LoadInt32(count) != 3 {
+		t.Fatalf("retry status %d requests %d", resp.StatusCode, *count)
+	}
+
+	spans := GetMockSpans(tracer, "http.client")
+	if len(spans) != 3 {
+		t.Fatalf("retry http.client spans %d", len(spans))
+	}
+	for i, span := range spans {
+		if !HasMockTag(span, "http.attempt", i+1) || !IsMockChildOf(span, GetMockSpans(tracer, "parent")[0]) {
+			t.Errorf("retry span %d attempt %v", i, span.Tag("http.attempt"))
+		}
+	}
+	if !HasMockLog(GetMockSpans(tracer, "parent")[0], "event", "retry") {
+		t.Error("retry not log parent span")
+	}
+}
+
+func TestRetryHTTPClientBody(t *testing.T) {
+	srv, count := newRetryServer(1)
+	defer srv.Close()
+	client := NewRetryHTTPClient(&http.Client{}, &RetryConfig{MinBackoff: time.Millisecond})
+
+	// 带有幂等key的POST请求使用GetBody重新发送body。
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("hello"))
+	req.Header.Set("Idempotency-Key", "1")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" || atomic.LoadInt32(count) != 2 {
+		t.Fatalf("retry body %q requests %d", body, *count)
+	}
+
+	// 没有幂等key的POST请求不重试。
+	atomic.StoreInt32(count, 0)
+	resp, err = client.Post(srv.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(count) != 1 {
+		t.Fatalf("post retry status %d requests %d", resp.StatusCode, *count)
+	}
+}
+
+func TestRetryHTTPClientRetryAfter(t *testing.T) {
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	resp, err := NewRetryHTTPClient(&http.Client{}, &RetryConfig{}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if atomic.LoadInt32(&count) != 1 {
+		t.Fatalf("retry after exceed MaxRetryAfter requests %d", count)
+	}
+}
+
+func TestRetryHTTPClientBudget(t *testing.T) {
+	srv, count := newRetryServer(100)
+	defer srv.Close()
+	client := NewRetryHTTPClient(&http.Client{}, &RetryConfig{MinBackoff: time.Millisecond, Budget: 0.1, BudgetBurst: 2})
+	for i := 0; i < 5; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// 5个请求，令牌桶最多2个令牌并每个请求增加0.1个令牌，重试次数不超过2。
+	if n := atomic.LoadInt32(count); n > 7 {
+		t.Fatalf("retry budget requests %d", n)
+	}
+}
+
+func TestRetryHTTPClientCopy(t *testing.T) {
+	client := &http.Client{}
+	if NewRetryHTTPClient(client, &RetryConfig{}) == client || client.Transport != nil {
+		t.Fatal("retry client modify origin client")
+	}
+}
+
+func TestRetryHTTPClientError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	for _, expect := range []struct {
+		url   string
+		tries int32
+	}{
+		// 连接被拒绝重试。
+		{"http://" + addr, 3},
+		// 协议错误不重试。
+		{"ftp://" + addr, 1},
+	} {
+		var tries int32
+		client := NewRetryHTTPClient(&http.Client{Transport: retryCountTransport{&tries, http.DefaultTransport}},
+			&RetryConfig{MinBackoff: time.Millisecond})
+		_, err := client.Get(expect.url)
+		if err == nil || atomic.LoadInt32(&tries) != expect.tries {
+			t.Errorf("retry %s tries %d error %v", expect.url, tries, err)
+		}
+	}
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	var tries int32
+	client := NewRetryHTTPClient(&http.Client{Transport: retryCountTransport{&tries, http.DefaultTransport}},
+		&RetryConfig{MinBackoff: time.Millisecond})
+	_, err = client.Get(srv.URL)
+	if err == nil || atomic.LoadInt32(&tries) != 1 {
+		t.Errorf("retry tls verify tries %d error %v", tries, err)
+	}
+}
+
+type retryCountTransport struct {
+	count *int32
+	next  http.RoundTripper
+}
+
+func (t retryCountTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(t.count, 1)
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,187 @@
+package tracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/eudore/eudore"
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/thrift-gen/sampling"
+)
+
+// SamplerConfig 定义采样配置。
+//
+// Type可选const、probabilistic、ratelimiting、remote、file，
+// remote从Server拉取采样策略，file读取jaeger采样策略文件File。
+//
+// Routes定义action参数对应的概率采样率，覆盖默认采样。
+//
+// Type为tail时使用尾部采样，全部span在进程内缓存到请求结束，
+// 保留错误、status大于等于500、持续时间超过Slow的trace，其他trace按照Param(或Routes)概率保留；
+// Timeout定义未完成trace的最长缓存时间，MaxTraces定义最多缓存trace数量。
+type SamplerConfig struct {
+	Type      string             `json:"type" alias:"type"`
+	Param     float64            `json:"param" alias:"param"`
+	Server    string             `json:"server" alias:"server"`
+	File      string             `json:"file" alias:"file"`
+	Refresh   time.Duration      `json:"refresh" alias:"refresh"`
+	Routes    map[string]float64 `json:"routes" alias:"routes"`
+	Slow      time.Duration      `json:"slow" alias:"slow"`
+	Timeout   time.Duration      `json:"timeout" alias:"timeout"`
+	MaxTraces int                `json:"maxtraces" alias:"maxtraces"`
+}
+
+type samplerStrategies struct {
+	ServiceStrategies []samplerStrategy `json:"service_strategies"`
+	DefaultStrategy   *samplerStrategy  `json:"default_strategy"`
+}
+
+type samplerStrategy struct {
+	Service             string            `json:"service"`
+	Operation           string            `json:"operation"`
+	Type                string            `json:"type"`
+	Param               float64           `json:"param"`
+	OperationStrategies []samplerStrategy `json:"operation_strategies"`
+}
+
+// routeSampler 定义按照span名称(action参数)选择的采样器。
+type routeSampler struct {
+	jaeger.SamplerV2
+	Routes map[string]jaeger.SamplerV2
+}
+
+// newSampler 函数使用配置创建jaeger采样器。
+func newSampler(config *Config, logger jaeger.Logger) (jaeger.Sampler, error) {
+	if config.Sampler.Type == "" {
+		config.Sampler.Type = jaeger.SamplerTypeConst
+		config.Sampler.Param = 1
+	}
+
+	var sampler jaeger.Sampler
+	var err error
+	switch config.Sampler.Type {
+	case jaeger.SamplerTypeRemote:
+		var initial *jaeger.ProbabilisticSampler
+		initial, err = jaeger.NewProbabilisticSampler(config.Sampler.Param)
+		if err == nil {
+			sampler = jaeger.NewRemotelyControlledSampler(config.ServiceName,
+				jaeger.SamplerOptions.InitialSampler(initial),
+				jaeger.SamplerOptions.SamplingServerURL(eudore.GetString(config.Sampler.Server, "http://127.0.0.1:5778/sampling")),
+				jaeger.SamplerOptions.SamplingRefreshInterval(config.Sampler.Refresh),
+				jaeger.SamplerOptions.Logger(logger),
+			)
+		}
+	case "file":
+		sampler, err = newSamplerFile(config.ServiceName, config.Sampler.File)
+	case SamplerTypeTail:
+		// 尾部采样全部记录span，在tailReporter决定是否保留。
+		return jaeger.NewConstSampler(true), nil
+	default:
+		sampler, err = newSamplerStrategy(&samplerStrategy{Type: config.Sampler.Type, Param: config.Sampler.Param})
+	}
+	if err != nil || len(config.Sampler.Routes) == 0 {
+		return sampler, err
+	}
+
+	routes := make(map[string]jaeger.SamplerV2, len(config.Sampler.Routes))
+	for route, rate := range config.Sampler.Routes {
+		s, err := jaeger.NewProbabilisticSampler(rate)
+		if err != nil {
+			return nil, fmt.Errorf("tracer sampler route '%s' error: %s", route, err.Error())
+		}
+		routes[route] = s
+	}
+	return routeSampler{sampler.(jaeger.SamplerV2), routes}, nil
+}
+
+func newSamplerStrategy(strategy *samplerStrategy) (jaeger.Sampler, error) {
+	switch strategy.Type {
+	case jaeger.SamplerTypeConst:
+		return jaeger.NewConstSampler(strategy.Param != 0), nil
+	case jaeger.SamplerTypeProbabilistic:
+		if len(strategy.OperationStrategies) == 0 {
+			return jaeger.NewProbabilisticSampler(strategy.Param)
+		}
+		strategies := &sampling.PerOperationSamplingStrategies{DefaultSamplingProbability: strategy.Param}
+		for _, op := range strategy.OperationStrategies {
+			strategies.PerOperationStrategies = append(strategies.PerOperationStrategies, &sampling.OperationSamplingStrategy{
+				Operation:             op.Operation,
+				ProbabilisticSampling: &sampling.ProbabilisticSamplingStrategy{SamplingRate: op.Param},
+			})
+		}
+		return jaeger.NewPerOperationSampler(jaeger.PerOperationSamplerParams{Strategies: strategies}), nil
+	case jaeger.SamplerTypeRateLimiting:
+		return jaeger.NewRateLimitingSampler(strategy.Param), nil
+	default:
+		return nil, fmt.Errorf("未定义采样类型：'%s'", strategy.Type)
+	}
+}
+
+// newSamplerFile 函数读取jaeger采样策略文件，使用服务对应策略或默认策略。
+func newSamplerFile(service, path string) (jaeger.Sampler, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var strategies samplerStrategies
+	err = json.Unmarshal(body, &strategies)
+	if err != nil {
+		return nil, fmt.Errorf("tracer sampler file '%s' error: %s", path, err.Error())
+	}
+	for i := range strategies.ServiceStrategies {
+		if strategies.ServiceStrategies[i].Service == service {
+			return newSamplerStrategy(&strategies.ServiceStrategies[i])
+		}
+	}
+	if strategies.DefaultStrategy != nil {
+		return newSamplerStrategy(strategies.DefaultStrategy)
+	}
+	return nil, fmt.Errorf("tracer sampler file '%s' not found service '%s' strategy", path, service)
+}
+
+func (s routeSampler) getSampler(operation string) jaeger.SamplerV2 {
+	sampler, ok := s.Routes[operation]
+	if ok {
+		return sampler
+	}
+	return s.SamplerV2
+}
+
+func (s routeSampler) OnCreateSpan(span *jaeger.Span) jaeger.SamplingDecision {
+	return s.getSampler(span.OperationName()).OnCreateSpan(span)
+}
+
+func (s routeSampler) OnSetOperationName(span *jaeger.Span, operationName string) jaeger.SamplingDecision {
+	return s.getSampler(operationName).OnSetOperationName(span, operationName)
+}
+
+func (s routeSampler) OnSetTag(span *jaeger.Span, key string, value interface{}) jaeger.SamplingDecision {
+	return s.getSampler(span.OperationName()).OnSetTag(span, key, value)
+}
+
+func (s routeSampler) OnFinishSpan(span *jaeger.Span) jaeger.SamplingDecision {
+	return s.getSampler(span.OperationName()).OnFinishSpan(span)
+}
+
+func (s routeSampler) Close() {
+	s.SamplerV2.Close()
+	for _, sampler := range s.Routes {
+		sampler.Close()
+	}
+}
+
+// IsSampled 方法实现jaeger.Sampler接口，span采样使用SamplerV2接口，
+// 用于传播格式没有采样标志时使用operation对应的采样器决定。
+func (s routeSampler) IsSampled(id jaeger.TraceID, operation string) (bool, []jaeger.Tag) {
+	sampler, ok := s.getSampler(operation).(jaeger.Sampler)
+	if ok {
+		return sampler.IsSampled(id, operation)
+	}
+	return false, nil
+}
+
+func (s routeSampler) Equal(jaeger.Sampler) bool {
+	return false
+}
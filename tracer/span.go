@@ -0,0 +1,160 @@
+package tracer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanData 定义导出的span数据，格式兼容jaeger json，时间单位为微秒。
+type SpanData struct {
+	TraceID       string          `json:"traceID"`
+	SpanID        string          `json:"spanID"`
+	OperationName string          `json:"operationName"`
+	References    []SpanReference `json:"references,omitempty"`
+	StartTime     int64           `json:"startTime"`
+	Duration      int64           `json:"duration"`
+	Tags          []SpanKeyValue  `json:"tags"`
+	Logs          []SpanLog       `json:"logs,omitempty"`
+	Process       SpanProcess     `json:"process"`
+}
+
+// SpanReference 定义span引用。
+type SpanReference struct {
+	RefType string `json:"refType"`
+	TraceID string `json:"traceID"`
+	SpanID  string `json:"spanID"`
+}
+
+// SpanKeyValue 定义span的tag或日志字段。
+type SpanKeyValue struct {
+	Key   string      `json:"key"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// SpanLog 定义span日志。
+type SpanLog struct {
+	Timestamp int64          `json:"timestamp"`
+	Fields    []SpanKeyValue `json:"fields"`
+}
+
+// SpanProcess 定义span所属服务。
+type SpanProcess struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// newSpanDataJaeger 函数转换jaeger span。
+func newSpanDataJaeger(span *jaeger.Span, service string) *SpanData {
+	ctx := span.SpanContext()
+	data := &SpanData{
+		TraceID:       ctx.TraceID().String(),
+		SpanID:        ctx.SpanID().String(),
+		OperationName: span.OperationName(),
+		StartTime:     span.StartTime().UnixNano() / 1e3,
+		Duration:      int64(span.Duration() / time.Microsecond),
+		Process:       SpanProcess{ServiceName: service},
+	}
+	for _, ref := range span.References() {
+		refCtx, ok := ref.ReferencedContext.(jaeger.SpanContext)
+		if ok {
+			refType := "CHILD_OF"
+			if ref.Type == opentracing.FollowsFromRef {
+				refType = "FOLLOWS_FROM"
+			}
+			data.References = append(data.References, SpanReference{refType, refCtx.TraceID().String(), refCtx.SpanID().String()})
+		}
+	}
+	if len(data.References) == 0 && ctx.ParentID() != 0 {
+		data.References = append(data.References, SpanReference{"CHILD_OF", data.TraceID, ctx.ParentID().String()})
+	}
+	for key, val := range span.Tags() {
+		data.Tags = append(data.Tags, newSpanKeyValue(key, val))
+	}
+	for _, record := range span.Logs() {
+		log := SpanLog{Timestamp: record.Timestamp.UnixNano() / 1e3}
+		for _, field := range record.Fields {
+			log.Fields = append(log.Fields, newSpanKeyValue(field.Key(), field.Value()))
+		}
+		data.Logs = append(data.Logs, log)
+	}
+	return data
+}
+
+// newSpanDataOpentelemetry 函数转换opentelemetry span。
+func newSpanDataOpentelemetry(span sdktrace.ReadOnlySpan) *SpanData {
+	ctx := span.SpanContext()
+	data := &SpanData{
+		TraceID:       ctx.TraceID().String(),
+		SpanID:        ctx.SpanID().String(),
+		OperationName: span.Name(),
+		StartTime:     span.StartTime().UnixNano() / 1e3,
+		Duration:      int64(span.EndTime().Sub(span.StartTime()) / time.Microsecond),
+	}
+	if span.Parent().HasSpanID() {
+		data.References = append(data.References, SpanReference{"CHILD_OF", span.Parent().TraceID().String(), span.Parent().SpanID().String()})
+	}
+	for _, attr := range span.Attributes() {
+		data.Tags = append(data.Tags, newSpanKeyValue(string(attr.Key), attr.Value.AsInterface()))
+	}
+	// opentracing bridge将span.kind转换成SpanKind，不会保存为属性。
+	if kind := span.SpanKind(); kind != trace.SpanKindUnspecified && kind != trace.SpanKindInternal && data.GetTag("span.kind") == nil {
+		data.Tags = append(data.Tags, newSpanKeyValue("span.kind", kind.String()))
+	}
+	if span.Status().Code == codes.Error {
+		data.Tags = append(data.Tags, newSpanKeyValue("error", true))
+	}
+	for _, event := range span.Events() {
+		log := SpanLog{Timestamp: event.Time.UnixNano() / 1e3, Fields: []SpanKeyValue{newSpanKeyValue("event", event.Name)}}
+		for _, attr := range event.Attributes {
+			log.Fields = append(log.Fields, newSpanKeyValue(string(attr.Key), attr.Value.AsInterface()))
+		}
+		data.Logs = append(data.Logs, log)
+	}
+	if name, ok := span.Resource().Set().Value(attribute.Key("service.name")); ok {
+		data.Process.ServiceName = name.AsString()
+	}
+	return data
+}
+
+func newSpanKeyValue(key string, val interface{}) SpanKeyValue {
+	switch v := val.(type) {
+	case string:
+		return SpanKeyValue{key, "string", v}
+	case bool:
+		return SpanKeyValue{key, "bool", v}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return SpanKeyValue{key, "int64", v}
+	case float32, float64:
+		return SpanKeyValue{key, "float64", v}
+	default:
+		return SpanKeyValue{key, "string", fmt.Sprint(v)}
+	}
+}
+
+// GetTag 方法返回span指定tag的值。
+func (data *SpanData) GetTag(key string) interface{} {
+	for _, tag := range data.Tags {
+		if tag.Key == key {
+			return tag.Value
+		}
+	}
+	return nil
+}
+
+// GetParentID 方法返回父span id，根span返回空字符串。
+func (data *SpanData) GetParentID() string {
+	for _, ref := range data.References {
+		if ref.RefType == "CHILD_OF" && strings.TrimLeft(ref.SpanID, "0") != "" {
+			return ref.SpanID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,220 @@
+package tracer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// SamplerTypeTail 定义尾部采样类型。
+const SamplerTypeTail = "tail"
+
+// tailBuffer 定义尾部采样缓冲区，按照trace缓存span，直到请求的server span完成后决定是否保留trace。
+//
+// status大于等于500、存在error tag或者持续时间超过Slow时保留trace，否则按照Param(或Routes)概率保留；
+// 超过Timeout未完成的trace和超过MaxTraces时最早的trace，按照相同规则直接决定。
+//
+// 尾部采样忽略上游的未采样标记，上游未采样的trace同样缓存后决定。
+type tailBuffer struct {
+	sync.Mutex
+	*SamplerConfig
+	traces    map[string]*tailTrace
+	decisions map[string]tailDecision
+	cleaned   time.Time
+}
+
+type tailTrace struct {
+	created time.Time
+	error   bool
+	reports []func(bool)
+}
+
+type tailDecision struct {
+	keep    bool
+	created time.Time
+}
+
+type tailReporter struct {
+	*tailBuffer
+	next        jaeger.Reporter
+	ServiceName string
+}
+
+type tailProcessor struct {
+	*tailBuffer
+	next sdktrace.SpanProcessor
+}
+
+func newTailBuffer(config *SamplerConfig) *tailBuffer {
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.MaxTraces == 0 {
+		config.MaxTraces = 10000
+	}
+	return &tailBuffer{
+		SamplerConfig: config,
+		traces:        make(map[string]*tailTrace),
+		decisions:     make(map[string]tailDecision),
+		cleaned:       time.Now(),
+	}
+}
+
+// tailPropagator 定义尾部采样使用的传播格式，Extract结果设置为采样，使上游未采样的trace也能被缓存。
+type tailPropagator struct {
+	propagator
+}
+
+// Add 方法添加一个完成的span，决定后调用report函数，参数为是否保留span。
+func (b *tailBuffer) Add(span *SpanData, report func(bool)) {
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+	if now.Sub(b.cleaned) > time.Second {
+		b.clean(now)
+	}
+
+	decision, ok := b.decisions[span.TraceID]
+	if ok {
+		report(decision.keep)
+		return
+	}
+
+	trace, ok := b.traces[span.TraceID]
+	if !ok {
+		if len(b.traces) >= b.MaxTraces {
+			b.evict()
+		}
+		trace = &tailTrace{created: now}
+		b.traces[span.TraceID] = trace
+	}
+	trace.reports = append(trace.reports, report)
+	if span.GetTag("error") == true {
+		trace.error = true
+	}
+	if span.GetTag("span.kind") == "server" {
+		keep := trace.error || getSpanTagInt(span.GetTag("http.status")) >= 500 ||
+			(b.Slow > 0 && span.Duration >= int64(b.Slow/time.Microsecond)) ||
+			b.sample(span.OperationName)
+		b.decide(span.TraceID, trace, keep, now)
+	}
+}
+
+func (b *tailBuffer) sample(operation string) bool {
+	rate, ok := b.Routes[operation]
+	if !ok {
+		rate = b.Param
+	}
+	return rand.Float64() < rate
+}
+
+func (b *tailBuffer) decide(id string, trace *tailTrace, keep bool, now time.Time) {
+	for _, report := range trace.reports {
+		report(keep)
+	}
+	delete(b.traces, id)
+	b.decisions[id] = tailDecision{keep, now}
+}
+
+// clean 方法决定超时的trace，删除过期的决定。
+func (b *tailBuffer) clean(now time.Time) {
+	b.cleaned = now
+	for id, trace := range b.traces {
+		if now.Sub(trace.created) > b.Timeout {
+			b.decide(id, trace, trace.error || b.sample(""), now)
+		}
+	}
+	for id, decision := range b.decisions {
+		if now.Sub(decision.created) > b.Timeout {
+			delete(b.decisions, id)
+		}
+	}
+}
+
+func (b *tailBuffer) evict() {
+	var oldest string
+	var created time.Time
+	for id, trace := range b.traces {
+		if oldest == "" || trace.created.Before(created) {
+			oldest, created = id, trace.created
+		}
+	}
+	if oldest != "" {
+		trace := b.traces[oldest]
+		b.decide(oldest, trace, trace.error || b.sample(""), time.Now())
+	}
+}
+
+// Flush 方法决定全部未完成的trace。
+func (b *tailBuffer) Flush() {
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+	for id, trace := range b.traces {
+		b.decide(id, trace, trace.error || b.sample(""), now)
+	}
+}
+
+// Report 方法缓存span，Report返回后tracer会Release span，
+// 启用span池时span可能被复用，因此缓存期间Retain span，决定后Release。
+func (r tailReporter) Report(span *jaeger.Span) {
+	span.Retain()
+	r.Add(newSpanDataJaeger(span, r.ServiceName), func(keep bool) {
+		if keep {
+			r.next.Report(span)
+		}
+		span.Release()
+	})
+}
+
+func (r tailReporter) Close() {
+	r.Flush()
+	r.next.Close()
+}
+
+func (p tailProcessor) OnStart(ctx context.Context, span sdktrace.ReadWriteSpan) {
+	p.next.OnStart(ctx, span)
+}
+
+func (p tailProcessor) OnEnd(span sdktrace.ReadOnlySpan) {
+	p.Add(newSpanDataOpentelemetry(span), func(keep bool) {
+		if keep {
+			p.next.OnEnd(span)
+		}
+	})
+}
+
+func (p tailProcessor) Shutdown(ctx context.Context) error {
+	p.Flush()
+	return p.next.Shutdown(ctx)
+}
+
+func (p tailProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+func (p tailPropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	ctx, err := p.propagator.Extract(carrier)
+	if err != nil || ctx.IsSampled() || !ctx.TraceID().IsValid() {
+		return ctx, err
+	}
+	// tracer.Extract将结果标记为remote，使用上游采样决定，因此在这里设置采样。
+	sampled, err := jaeger.ContextFromString(fmt.Sprintf("%s:%s:%s:%x", ctx.TraceID(), ctx.SpanID(), ctx.ParentID(), ctx.Flags()|1))
+	if err != nil {
+		return ctx, nil
+	}
+	state, _ := ctx.ExtendedSamplingState(propagatorTraceState, func() interface{} { return "" }).(string)
+	if state != "" {
+		sampled.ExtendedSamplingState(propagatorTraceState, func() interface{} { return state })
+	}
+	ctx.ForeachBaggageItem(func(k, v string) bool {
+		sampled = sampled.WithBaggageItem(k, v)
+		return true
+	})
+	return sampled, nil
+}
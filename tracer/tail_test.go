@@ -0,0 +1,172 @@
+package tracer
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+)
+
+type tailRecorder struct {
+	kept    []string
+	dropped []string
+}
+
+func (r *tailRecorder) add(b *tailBuffer, span *SpanData) {
+	b.Add(span, func(keep bool) {
+		if keep {
+			r.kept = append(r.kept, span.SpanID)
+		} else {
+			r.dropped = append(r.dropped, span.SpanID)
+		}
+	})
+}
+
+func newTailSpan(trace, span string, duration time.Duration, tags ...SpanKeyValue) *SpanData {
+	return &SpanData{TraceID: trace, SpanID: span, OperationName: "op", Duration: int64(duration / time.Microsecond), Tags: tags}
+}
+
+func newTailServerSpan(trace, span string, status int, duration time.Duration) *SpanData {
+	return newTailSpan(trace, span, duration,
+		newSpanKeyValue("span.kind", "server"),
+		newSpanKeyValue("http.status", status),
+	)
+}
+
+func TestTailBufferDecision(t *testing.T) {
+	r := &tailRecorder{}
+	b := newTailBuffer(&SamplerConfig{Slow: 100 * time.Millisecond})
+
+	// server span完成前不决定。
+	r.add(b, newTailSpan("t1", "t1-db", time.Millisecond))
+	if len(r.kept)+len(r.dropped) != 0 {
+		t.Fatalf("tail decide before server span: %v %v", r.kept, r.dropped)
+	}
+	r.add(b, newTailServerSpan("t1", "t1-server", 503, time.Millisecond))
+	r.add(b, newTailSpan("t2", "t2-db", time.Millisecond, newSpanKeyValue("error", true)))
+	r.add(b, newTailServerSpan("t2", "t2-server", 200, time.Millisecond))
+	r.add(b, newTailServerSpan("t3", "t3-server", 200, 200*time.Millisecond))
+	r.add(b, newTailSpan("t4", "t4-db", time.Millisecond))
+	r.add(b, newTailServerSpan("t4", "t4-server", 200, time.Millisecond))
+	// 决定后的span使用相同决定。
+	r.add(b, newTailSpan("t1", "t1-late", time.Millisecond))
+	r.add(b, newTailSpan("t4", "t4-late", time.Millisecond))
+
+	expectIDs(t, "kept", r.kept, "t1-db", "t1-server", "t2-db", "t2-server", "t3-server", "t1-late")
+	expectIDs(t, "dropped", r.dropped, "t4-db", "t4-server", "t4-late")
+}
+
+func TestTailBufferBaseRate(t *testing.T) {
+	r := &tailRecorder{}
+	b := newTailBuffer(&SamplerConfig{Param: 0, Routes: map[string]float64{"keep": 1}})
+	for i := 0; i < 10; i++ {
+		id := strconv.Itoa(i)
+		span := newTailServerSpan(id, id, 200, time.Millisecond)
+		if i%2 == 0 {
+			span.OperationName = "keep"
+		}
+		r.add(b, span)
+	}
+	expectIDs(t, "kept", r.kept, "0", "2", "4", "6", "8")
+
+	r = &tailRecorder{}
+	b = newTailBuffer(&SamplerConfig{Param: 1})
+	r.add(b, newTailServerSpan("t1", "t1", 200, time.Millisecond))
+	expectIDs(t, "kept", r.kept, "t1")
+}
+
+func TestTailBufferEvict(t *testing.T) {
+	r := &tailRecorder{}
+	b := newTailBuffer(&SamplerConfig{MaxTraces: 2})
+	r.add(b, newTailSpan("t1", "t1-db", time.Millisecond, newSpanKeyValue("error", true)))
+	time.Sleep(time.Millisecond)
+	r.add(b, newTailSpan("t2", "t2-db", time.Millisecond))
+	time.Sleep(time.Millisecond)
+	r.add(b, newTailSpan("t3", "t3-db", time.Millisecond))
+	expectIDs(t, "kept", r.kept, "t1-db")
+	time.Sleep(time.Millisecond)
+	r.add(b, newTailSpan("t4", "t4-db", time.Millisecond))
+	expectIDs(t, "dropped", r.dropped, "t2-db")
+	if len(b.traces) != 2 {
+		t.Errorf("tail traces %d", len(b.traces))
+	}
+
+	b.Flush()
+	expectIDs(t, "dropped", r.dropped, "t2-db", "t3-db", "t4-db")
+}
+
+func expectIDs(t *testing.T, name string, got []string, ids ...string) {
+	t.Helper()
+	has := make(map[string]bool, len(got))
+	for _, id := range got {
+		has[id] = true
+	}
+	for _, id := range ids {
+		if !has[id] {
+			t.Errorf("tail %s not has %s: %v", name, id, got)
+		}
+	}
+	if len(got) != len(ids) {
+		t.Errorf("tail %s %v, want %v", name, got, ids)
+	}
+}
+
+// tailCopyReporter 在Report时复制span数据，检查缓存的span没有被span池复用。
+type tailCopyReporter struct {
+	spans []*SpanData
+}
+
+func (r *tailCopyReporter) Report(span *jaeger.Span) {
+	r.spans = append(r.spans, newSpanDataJaeger(span, "tail"))
+}
+
+func (r *tailCopyReporter) Close() {}
+
+func TestTailReporterJaeger(t *testing.T) {
+	next := &tailCopyReporter{}
+	propagator, _ := newPropagator([]string{"w3c"}, nil)
+	tracer, closer := jaeger.NewTracer("tail", jaeger.NewConstSampler(true),
+		tailReporter{newTailBuffer(&SamplerConfig{}), next, "tail"},
+		jaeger.TracerOptions.PoolSpans(true),
+		jaeger.TracerOptions.Injector(opentracing.HTTPHeaders, tailPropagator{propagator}),
+		jaeger.TracerOptions.Extractor(opentracing.HTTPHeaders, tailPropagator{propagator}),
+	)
+	defer closer.Close()
+
+	// 上游未采样的trace也需要缓存后决定。
+	header := http.Header{}
+	header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+	header.Set("tracestate", "vendor=1")
+	parent, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := tracer.StartSpan("server", ext.RPCServerOption(parent))
+	db := tracer.StartSpan("db", opentracing.ChildOf(server.Context()))
+	db.Finish()
+	// 缓存期间创建的span复用span池，缓存的span不能被覆盖。
+	for i := 0; i < 10; i++ {
+		tracer.StartSpan("other").Finish()
+	}
+	carrier := http.Header{}
+	tracer.Inject(server.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(carrier))
+	if carrier.Get("tracestate") != "vendor=1" {
+		t.Errorf("tail propagator lost tracestate: %v", carrier)
+	}
+	server.SetTag("http.status", 500)
+	server.Finish()
+
+	var names []string
+	for _, span := range next.spans {
+		if span.TraceID == "0af7651916cd43dd8448eb211c80319c" {
+			names = append(names, span.OperationName)
+		}
+	}
+	if len(names) != 2 || names[0] != "db" || names[1] != "server" {
+		t.Errorf("tail jaeger kept spans %v", names)
+	}
+}
@@ -1,17 +1,21 @@
 package tracer
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/eudore/eudore"
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/uber/jaeger-client-go"
 	jaegerconfig "github.com/uber/jaeger-client-go/config"
 	jaegerprometheus "github.com/uber/jaeger-lib/metrics/prometheus"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 /*
@@ -37,11 +41,36 @@ var (
 type Tracer = opentracing.Tracer
 
 // Config 定义配置。
+//
+// Backend可选jaeger、opentelemetry、mock，opentelemetry使用Protocol(grpc、http)发送OTLP数据到Agent，
+// mock在内存记录span用于测试。
+//
+// Propagators定义http header传播格式，可选jaeger、w3c、b3、b3single，
+// 多个格式时提取第一个存在的格式，注入全部格式。
+//
+// File.Path或Agent使用file://前缀时span写入本地文件，不再发送到Agent。
+//
+// LoggerLevel定义写入span的最低日志级别，LoggerFieldSize定义写入span的日志字段最大长度。
+//
+// Baggage定义baggage的允许key和大小限制，以及复制到日志和exemplar的key。
+//
+// Recent大于0时在内存保存最近Recent个trace到RecentTraces，用于NewRecentHandler查看。
 type Config struct {
-	ServiceName string                `json:"servicename" alias:"servicename"`
-	Agent       string                `json:"agent" alias:"agent"`
-	Logger      eudore.Logger         `json:"-" alias:"-"`
-	Registerer  prometheus.Registerer `json:"-" alias:"-"`
+	ServiceName     string                `json:"servicename" alias:"servicename"`
+	Backend         string                `json:"backend" alias:"backend"`
+	Agent           string                `json:"agent" alias:"agent"`
+	Protocol        string                `json:"protocol" alias:"protocol"`
+	Insecure        bool                  `json:"insecure" alias:"insecure"`
+	Sampler         SamplerConfig         `json:"sampler" alias:"sampler"`
+	Propagators     []string              `json:"propagators" alias:"propagators"`
+	File            FileConfig            `json:"file" alias:"file"`
+	Baggage         BaggageConfig         `json:"baggage" alias:"baggage"`
+	Recent          int                   `json:"recent" alias:"recent"`
+	RecentTraces    *RecentTraces         `json:"-" alias:"-"`
+	LoggerLevel     eudore.LoggerLevel    `json:"loggerlevel" alias:"loggerlevel"`
+	LoggerFieldSize int                   `json:"loggerfieldsize" alias:"loggerfieldsize"`
+	Logger          eudore.Logger         `json:"-" alias:"-"`
+	Registerer      prometheus.Registerer `json:"-" alias:"-"`
 }
 
 // NewOpentracing 函数使用配置创建Tracer。
@@ -50,6 +79,24 @@ func NewOpentracing(config *Config) (opentracing.Tracer, error) {
 		return nil, errors.New("Opentracing ServiceName muest no-nil")
 	}
 
+	config.Backend = eudore.GetString(config.Backend, "jaeger")
+	newFileConfig(config)
+	if config.Recent > 0 && config.RecentTraces == nil {
+		config.RecentTraces = NewRecentTraces(config.Recent)
+	}
+	switch config.Backend {
+	case "jaeger":
+		return newJaeger(config)
+	case "opentelemetry":
+		return NewOpentelemetry(config)
+	case "mock":
+		return NewMockTracer(), nil
+	default:
+		return nil, fmt.Errorf("未定义tracer类型：'%s'", config.Backend)
+	}
+}
+
+func newJaeger(config *Config) (opentracing.Tracer, error) {
 	config.Agent = eudore.GetString(config.Agent, "127.0.0.1:6831")
 	cfg := jaegerconfig.Configuration{
 		ServiceName: config.ServiceName,
@@ -59,22 +106,67 @@ func NewOpentracing(config *Config) (opentracing.Tracer, error) {
 			JaegerBaggageHeader:      OpentracingBaggageHeader,
 			JaegerDebugHeader:        OpentracingDebugHeader,
 		},
-		Sampler: &jaegerconfig.SamplerConfig{
-			Type:  jaeger.SamplerTypeConst,
-			Param: 1,
-		},
 		Reporter: &jaegerconfig.ReporterConfig{
 			LocalAgentHostPort: config.Agent,
 			// LogSpans:           true,
 		},
 	}
 
-	var options []jaegerconfig.Option
+	var logger jaeger.Logger = jaeger.NullLogger
 	if config.Logger != nil {
-		options = append(options, jaegerconfig.Logger(&traceLogger{config.Logger}))
+		logger = &traceLogger{config.Logger}
+	}
+	sampler, err := newSampler(config, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Propagators) == 0 {
+		config.Propagators = []string{"jaeger"}
 	}
+	propagator, err := newPropagator(config.Propagators, sampler)
+	if err != nil {
+		return nil, err
+	}
+	if config.Sampler.Type == SamplerTypeTail {
+		propagator = tailPropagator{propagator}
+	}
+
+	options := []jaegerconfig.Option{
+		jaegerconfig.Logger(logger),
+		jaegerconfig.Sampler(sampler),
+		jaegerconfig.Injector(opentracing.HTTPHeaders, propagator),
+		jaegerconfig.Extractor(opentracing.HTTPHeaders, propagator),
+	}
+	metrics := jaeger.NewNullMetrics()
 	if config.Registerer != nil {
-		options = append(options, jaegerconfig.Metrics(jaegerprometheus.New(jaegerprometheus.WithRegisterer(config.Registerer))))
+		factory := jaegerprometheus.New(jaegerprometheus.WithRegisterer(config.Registerer))
+		metrics = jaeger.NewMetrics(factory, nil)
+		options = append(options, jaegerconfig.Metrics(factory))
+	}
+
+	var reporter jaeger.Reporter
+	if config.File.Path != "" {
+		writer, err := newFileWriter(&config.File, config.Logger)
+		if err != nil {
+			return nil, err
+		}
+		reporter = newFileReporter(writer, config.ServiceName)
+	}
+	if reporter == nil && (config.RecentTraces != nil || config.Sampler.Type == SamplerTypeTail) {
+		reporter, err = cfg.Reporter.NewReporter(config.ServiceName, metrics, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.Sampler.Type == SamplerTypeTail {
+		reporter = tailReporter{newTailBuffer(&config.Sampler), reporter, config.ServiceName}
+	}
+	if config.RecentTraces != nil {
+		reporter = jaeger.NewCompositeReporter(reporter, recentReporter{config.RecentTraces, config.ServiceName})
+	}
+	if reporter != nil {
+		options = append(options, jaegerconfig.Reporter(reporter))
 	}
 
 	tracer, _, err := cfg.NewTracer(options...)
@@ -85,29 +177,75 @@ func NewOpentracing(config *Config) (opentracing.Tracer, error) {
 	return tracer, err
 }
 
+// GetTraceID 函数返回context中span的trace id。
+func GetTraceID(ctx context.Context) string {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+	switch spanCtx := span.Context().(type) {
+	case jaeger.SpanContext:
+		return spanCtx.TraceID().String()
+	case mocktracer.MockSpanContext:
+		return strconv.Itoa(spanCtx.TraceID)
+	}
+	if spanCtx := oteltrace.SpanContextFromContext(ctx); spanCtx.HasTraceID() {
+		return spanCtx.TraceID().String()
+	}
+	return ""
+}
+
+// IsSampled 函数返回context中span是否被采样。
+func IsSampled(ctx context.Context) bool {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return false
+	}
+	switch spanCtx := span.Context().(type) {
+	case jaeger.SpanContext:
+		return spanCtx.IsSampled()
+	case mocktracer.MockSpanContext:
+		return spanCtx.Sampled
+	}
+	return oteltrace.SpanContextFromContext(ctx).IsSampled()
+}
+
 // NewOpentracingHandler 函数创建eudore http请求处理中间件函数，创建span相关对象。
-func NewOpentracingHandler(tracer opentracing.Tracer) eudore.HandlerFunc {
+//
+// 参数keys定义复制到请求日志字段的baggage key，同时保存到context用于prometheus exemplar。
+func NewOpentracingHandler(tracer opentracing.Tracer, keys ...string) eudore.HandlerFunc {
 	return func(ctx eudore.Context) {
 		spanCtx, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(ctx.Request().Header))
+		tags := opentracing.Tags{
+			"span.kind":       "server",
+			"http.user-agent": ctx.GetHeader("User-Agent"),
+			"http.method":     ctx.Method(),
+			"http.url":        ctx.Request().RequestURI,
+			"http.readip":     ctx.RealIP(),
+		}
+		if ctx.GetHeader(OpentracingDebugHeader) != "" {
+			tags[string(ext.SamplingPriority)] = uint16(1)
+		}
 		span := tracer.StartSpan(
 			eudore.GetString(ctx.GetParam(eudore.ParamAction), "ServeHTTP"),
 			opentracing.ChildOf(spanCtx),
 			opentracing.StartTime(time.Now()),
-			opentracing.Tags{
-				"span.kind":       "server",
-				"http.user-agent": ctx.GetHeader("User-Agent"),
-				"http.method":     ctx.Method(),
-				"http.url":        ctx.Request().RequestURI,
-				"http.readip":     ctx.RealIP(),
-			},
+			tags,
 		)
-		traceID := fmt.Sprint(span.Context())
-		pos := strings.IndexByte(traceID, ':')
-		if pos != -1 {
-			ctx.SetHeader(eudore.HeaderXTraceID, traceID[:pos])
-		}
 		ctx.WithContext(opentracing.ContextWithSpan(ctx.GetContext(), span))
-		ctx.SetLogger(ctx.Logger().WithField("context", ctx.GetContext()).WithField("x-trace-id", traceID[:pos]).WithFields(nil, nil))
+		traceID := GetTraceID(ctx.GetContext())
+		if traceID != "" {
+			ctx.SetHeader(eudore.HeaderXTraceID, traceID)
+		}
+		log := ctx.Logger().WithField("context", ctx.GetContext()).WithField("x-trace-id", traceID)
+		if len(keys) > 0 {
+			fields := newBaggageFields(span, keys)
+			for key, val := range fields {
+				log = log.WithField(key, val)
+			}
+			ctx.WithContext(context.WithValue(ctx.GetContext(), ContextItemBaggageFields, fields))
+		}
+		ctx.SetLogger(log.WithFields(nil, nil))
 
 		ctx.Next()
 		span.SetTag("http.status", ctx.Response().Status())